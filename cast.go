@@ -0,0 +1,149 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ActiveState/termtest/xpty"
+)
+
+// castHeader is the first line of an asciicast v2 file
+// See https://docs.asciinema.org/manual/asciicast/v2/
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castRecorder records the output, input and resize events of a terminal session in the asciicast v2 format
+// Recording errors do not interrupt the session, the first error is returned by Close()
+type castRecorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+	err   error
+	// partial holds the start of a rune that has been split between writes
+	partial []byte
+}
+
+func createCastRecorder(path string) (*castRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cast file: %w", err)
+	}
+	return &castRecorder{f: f}, nil
+}
+
+// begin writes the header of the recording, events are timed relative to this call
+func (r *castRecorder) begin(cols, rows int, title string, env map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.start = time.Now()
+	r.writeLine(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       env,
+	})
+}
+
+func (r *castRecorder) event(code string, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeEvent(code, data)
+}
+
+func (r *castRecorder) writeEvent(code string, data string) {
+	r.writeLine([]interface{}{time.Since(r.start).Seconds(), code, data})
+}
+
+func (r *castRecorder) writeLine(v interface{}) {
+	if r.err != nil || r.f == nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		_, err = r.f.Write(append(b, '\n'))
+	}
+	r.err = err
+}
+
+// Write records terminal output
+// A rune that is split between writes is recorded with the write that completes it.
+func (r *castRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	n := xpty.CompleteRunes(data)
+	r.partial = append([]byte(nil), data[n:]...)
+	if n > 0 {
+		r.writeEvent("o", string(data[:n]))
+	}
+	return len(p), nil
+}
+
+// observeSend records terminal input, it can be used as a SendObserver
+func (r *castRecorder) observeSend(msg string, num int, _ error) {
+	if num <= 0 || num > len(msg) {
+		return
+	}
+	r.event("i", msg[:num])
+}
+
+// resize records a change of the terminal size
+func (r *castRecorder) resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close closes the cast file and returns the first error that occurred while recording
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return r.err
+	}
+	if len(r.partial) > 0 {
+		r.writeEvent("o", string(r.partial))
+		r.partial = nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	if r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// castEnv returns the environment variables that asciicast headers contain from the process environment env
+// If env is nil, the process inherits the environment of the current process.
+func castEnv(env []string) map[string]string {
+	if env == nil {
+		env = os.Environ()
+	}
+	res := make(map[string]string)
+	for _, kv := range env {
+		for _, name := range []string{"TERM", "SHELL"} {
+			if strings.HasPrefix(kv, name+"=") {
+				res[name] = strings.TrimPrefix(kv, name+"=")
+			}
+		}
+	}
+	return res
+}
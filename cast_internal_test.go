@@ -0,0 +1,46 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCastRecorderSplitRunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "split.cast")
+	r, err := createCastRecorder(path)
+	require.NoError(t, err)
+	r.begin(80, 24, "", nil)
+
+	output := []byte("héllo ✓ wörld")
+	for i := range output {
+		_, err := r.Write(output[i : i+1])
+		require.NoError(t, err)
+	}
+	// an incomplete rune at the end of the session is recorded on close
+	_, _ = r.Write([]byte("\xe2\x9c"))
+	require.NoError(t, r.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan(), "read header")
+	var recorded strings.Builder
+	for scanner.Scan() {
+		var event []interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		recorded.WriteString(event[2].(string))
+	}
+	require.Equal(t, "héllo ✓ wörld\ufffd\ufffd", recorded.String())
+}
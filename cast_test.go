@@ -0,0 +1,73 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ActiveState/termtest"
+)
+
+func (suite *TermTestTestSuite) TestCastFile() {
+	castFile := filepath.Join(suite.tmpDir, "session.cast")
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:   termtest.TestSendObserveFn(suite.T()),
+		ObserveExpect: termtest.TestExpectObserveFn(suite.T()),
+		CmdName:       suite.sessionTester,
+		Args:          []string{"-read-keys"},
+		CastFile:      castFile,
+	})
+	suite.Require().NoError(err)
+
+	_, _ = cp.Expect("waiting for keys", 10*time.Second)
+	suite.Require().NoError(cp.Resize(100, 30))
+	cp.SendLine("hello")
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(cp.Close())
+
+	f, err := os.Open(castFile)
+	suite.Require().NoError(err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	suite.Require().True(scanner.Scan(), "read header")
+	var header struct {
+		Version int `json:"version"`
+		Width   int `json:"width"`
+		Height  int `json:"height"`
+	}
+	suite.Require().NoError(json.Unmarshal(scanner.Bytes(), &header))
+	suite.Equal(2, header.Version)
+	suite.Equal(80, header.Width)
+
+	var output, input strings.Builder
+	var resizes []string
+	var last float64
+	for scanner.Scan() {
+		var event []interface{}
+		suite.Require().NoError(json.Unmarshal(scanner.Bytes(), &event))
+		suite.Require().Len(event, 3)
+		ts := event[0].(float64)
+		suite.GreaterOrEqual(ts, last, "events are ordered by time")
+		last = ts
+		switch event[1] {
+		case "o":
+			output.WriteString(event[2].(string))
+		case "i":
+			input.WriteString(event[2].(string))
+		case "r":
+			resizes = append(resizes, event[2].(string))
+		}
+	}
+	suite.Contains(output.String(), "waiting for keys")
+	suite.Contains(output.String(), `received keys: "hello\n"`)
+	suite.Equal("hello\n", input.String())
+	suite.Equal([]string{"100x30"}, resizes)
+}
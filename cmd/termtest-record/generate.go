@@ -0,0 +1,279 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ActiveState/termtest/keys"
+)
+
+// recording is what the user typed during a session, and the output that preceded each input
+type recording struct {
+	args       []string
+	cols, rows int
+	inputs     []input
+	// final is the anchor of the output after the last input
+	final    string
+	exitCode int
+}
+
+// input is a chunk of bytes that the user typed
+type input struct {
+	// anchor is the line of output that preceded the input, it is empty if there was no output
+	// since the previous input
+	anchor string
+	data   string
+	// mode is the terminal mode that the bytes were sent in
+	mode keys.Mode
+}
+
+// maxAnchorLen is the maximum number of runes of an anchor
+const maxAnchorLen = 40
+
+// anchorOf returns the last non-empty line of the terminal output, shortened to maxAnchorLen runes
+func anchorOf(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\x00", " "), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := []rune(strings.TrimSpace(lines[i]))
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) > maxAnchorLen {
+			line = line[len(line)-maxAnchorLen:]
+			// start with a complete word if possible
+			if j := strings.IndexRune(string(line), ' '); j >= 0 {
+				line = []rune(strings.TrimSpace(string(line)[j:]))
+			}
+		}
+		return string(line)
+	}
+	return ""
+}
+
+// keystroke is either typed text or a key that is sent with SendKeys
+type keystroke struct {
+	text string
+	// expr is the Go expression of the key
+	expr string
+}
+
+// namedKey is a key that the recorder recognizes by its sequence
+type namedKey struct {
+	expr string
+	key  keys.Key
+}
+
+// namedKeys are tried in order, so keys that send the same sequence as a Ctrl combination come first
+var namedKeys = func() []namedKey {
+	ks := []namedKey{
+		{"keys.Enter", keys.Enter}, {"keys.Tab", keys.Tab}, {"keys.ShiftTab", keys.ShiftTab},
+		{"keys.Backspace", keys.Backspace}, {"keys.Escape", keys.Escape}, {"keys.Insert", keys.Insert},
+		{"keys.Delete", keys.Delete}, {"keys.PageUp", keys.PageUp}, {"keys.PageDown", keys.PageDown},
+		{"keys.Up", keys.Up}, {"keys.Down", keys.Down}, {"keys.Right", keys.Right}, {"keys.Left", keys.Left},
+		{"keys.Home", keys.Home}, {"keys.End", keys.End},
+		{"keys.F1", keys.F1}, {"keys.F2", keys.F2}, {"keys.F3", keys.F3}, {"keys.F4", keys.F4},
+		{"keys.F5", keys.F5}, {"keys.F6", keys.F6}, {"keys.F7", keys.F7}, {"keys.F8", keys.F8},
+		{"keys.F9", keys.F9}, {"keys.F10", keys.F10}, {"keys.F11", keys.F11}, {"keys.F12", keys.F12},
+		{"keys.KPEnter", keys.KPEnter},
+	}
+	for _, c := range "0123456789.+-*/=" {
+		ks = append(ks, namedKey{fmt.Sprintf("keys.Keypad(%q)", c), keys.Keypad(c)})
+	}
+	for c := '@'; c <= '_'; c++ {
+		expr := fmt.Sprintf("keys.Ctrl(%q)", c)
+		if c >= 'A' && c <= 'Z' {
+			expr = "keys.Ctrl" + string(c)
+		}
+		ks = append(ks, namedKey{expr, keys.Ctrl(c)})
+	}
+	return ks
+}()
+
+// splitKeys splits the bytes that the user typed in terminal mode m into text and keys
+func splitKeys(data string, m keys.Mode) []keystroke {
+	var res []keystroke
+	for data != "" {
+		// the longest matching sequence wins, printable characters are text
+		var match namedKey
+		for _, k := range namedKeys {
+			seq := k.key.Sequence(m)
+			if len(seq) > len(match.key.Sequence(m)) && strings.HasPrefix(data, seq) && !isText(seq) {
+				match = k
+			}
+		}
+		n := len(match.key.Sequence(m))
+
+		switch {
+		case data[0] == '\x1b' && len(data) > 1 && n <= 1:
+			if seq := escapeSequence(data); seq != "" {
+				res = append(res, keystroke{expr: fmt.Sprintf("keys.Text(%q)", seq)})
+				data = data[len(seq):]
+				continue
+			}
+			c, sz := utf8.DecodeRuneInString(data[1:])
+			if unicode.IsPrint(c) {
+				res = append(res, keystroke{expr: fmt.Sprintf("keys.Alt(%q)", c)})
+				data = data[1+sz:]
+				continue
+			}
+		case n == 0:
+			_, sz := utf8.DecodeRuneInString(data)
+			res = append(res, keystroke{text: data[:sz]})
+			data = data[sz:]
+			continue
+		}
+		res = append(res, keystroke{expr: match.expr})
+		data = data[n:]
+	}
+	return res
+}
+
+// isText returns true if seq is a printable character
+func isText(seq string) bool {
+	c, sz := utf8.DecodeRuneInString(seq)
+	return sz == len(seq) && unicode.IsPrint(c)
+}
+
+// escapeSequence returns the CSI or SS3 sequence at the start of data, or an empty string
+func escapeSequence(data string) string {
+	switch {
+	case strings.HasPrefix(data, "\x1bO") && len(data) > 2:
+		return data[:3]
+	case strings.HasPrefix(data, "\x1b["):
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return data[:i+1]
+			}
+		}
+	}
+	return ""
+}
+
+// generator turns the inputs of a recording into statements of a test
+type generator struct {
+	stmts []string
+	// line is the text typed since the last statement that sent input
+	line []rune
+	// keys are the keys of the last statement if it is a SendKeys call
+	keys     []string
+	usesKeys bool
+}
+
+func (g *generator) add(format string, args ...interface{}) {
+	g.stmts = append(g.stmts, fmt.Sprintf(format, args...))
+	g.keys = nil
+}
+
+// flush sends the text that has been typed so far
+func (g *generator) flush() {
+	if len(g.line) > 0 {
+		g.add("cp.SendUnterminated(%s)", quote(string(g.line)))
+		g.line = nil
+	}
+}
+
+func (g *generator) keystroke(k keystroke) {
+	switch {
+	case k.text != "":
+		g.line = append(g.line, []rune(k.text)...)
+	case k.expr == "keys.Backspace" && len(g.line) > 0:
+		g.line = g.line[:len(g.line)-1]
+	case k.expr == "keys.CtrlC":
+		g.flush()
+		g.add("cp.SendCtrlC()")
+	default:
+		g.flush()
+		ks := append(g.keys, k.expr)
+		if g.keys != nil {
+			g.stmts = g.stmts[:len(g.stmts)-1]
+		}
+		g.add("cp.SendKeys(%s)", strings.Join(ks, ", "))
+		g.keys = ks
+		g.usesKeys = true
+	}
+}
+
+// statements returns the statements that replay the inputs of rec and expect its output
+func (g *generator) statements(rec *recording) []string {
+	for _, in := range rec.inputs {
+		// the output while the user types a line is usually the echo of the input
+		if in.anchor != "" && len(g.line) == 0 {
+			g.add("cp.Expect(%s)", quote(in.anchor))
+		}
+		for _, k := range splitKeys(in.data, in.mode) {
+			g.keystroke(k)
+		}
+	}
+	g.flush()
+	if rec.final != "" {
+		g.add("cp.Expect(%s)", quote(rec.final))
+	}
+	if rec.exitCode < 0 {
+		// the process was terminated by a signal
+		g.add("cp.ExpectNotExitCode(0)")
+	} else {
+		g.add("cp.ExpectExitCode(%d)", rec.exitCode)
+	}
+	return g.stmts
+}
+
+// quote returns s as a Go string literal, raw strings are preferred for text with quotes or backslashes
+func quote(s string) string {
+	if strings.ContainsAny(s, "\"\\") && strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// generate writes a Go test function called name in package pkg that replays rec
+func generate(w io.Writer, rec *recording, pkg, name string) error {
+	g := &generator{}
+	stmts := g.statements(rec)
+	sized := rec.cols != 80 || rec.rows != 30
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\nimport (\n\t\"testing\"\n\n\t\"github.com/ActiveState/termtest\"\n", pkg)
+	if sized {
+		fmt.Fprintln(&buf, "\t\"github.com/ActiveState/termtest/expect\"")
+	}
+	if g.usesKeys {
+		fmt.Fprintln(&buf, "\t\"github.com/ActiveState/termtest/keys\"")
+	}
+	fmt.Fprintln(&buf, ")")
+
+	fmt.Fprintf(&buf, "\n// %s was recorded with termtest-record, review the expectations before you rely on it\n", name)
+	fmt.Fprintf(&buf, "func %s(t *testing.T) {\n\tcp, err := termtest.NewTest(t, termtest.Options{\n", name)
+	fmt.Fprintf(&buf, "CmdName: %s,\n", quote(rec.args[0]))
+	if len(rec.args) > 1 {
+		args := make([]string, len(rec.args)-1)
+		for i, arg := range rec.args[1:] {
+			args[i] = quote(arg)
+		}
+		fmt.Fprintf(&buf, "Args: []string{%s},\n", strings.Join(args, ", "))
+	}
+	if sized {
+		fmt.Fprintf(&buf, "ExtraOpts: []expect.ConsoleOpt{expect.WithTermCols(%d), expect.WithTermRows(%d)},\n", rec.cols, rec.rows)
+	}
+	fmt.Fprintf(&buf, "})\nif err != nil {\nt.Fatal(err)\n}\n\n")
+	for _, stmt := range stmts {
+		fmt.Fprintln(&buf, stmt)
+	}
+	fmt.Fprintln(&buf, "}")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
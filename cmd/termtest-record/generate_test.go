@@ -0,0 +1,98 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ActiveState/termtest/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnchorOf(t *testing.T) {
+	assert.Equal(t, "$", anchorOf("welcome\n$ \x00\x00"))
+	assert.Equal(t, "hello", anchorOf("$ echo hello\nhello\n\n"))
+	assert.Equal(t, "", anchorOf("\n  \n"))
+	assert.Equal(t, "sit amet, consectetur adipiscing elit:", anchorOf("Lorem ipsum dolor sit amet, consectetur adipiscing elit:"))
+}
+
+func TestSplitKeys(t *testing.T) {
+	assert.Equal(t, []keystroke{{text: "l"}, {text: "s"}, {expr: "keys.Enter"}}, splitKeys("ls\r", keys.Mode{}))
+	assert.Equal(t, []keystroke{{expr: "keys.Up"}, {expr: "keys.CtrlC"}}, splitKeys("\x1b[A\x03", keys.Mode{}))
+	assert.Equal(t, []keystroke{{expr: "keys.Up"}}, splitKeys("\x1bOA", keys.Mode{AppCursor: true}))
+	assert.Equal(t, []keystroke{{expr: "keys.F5"}, {expr: "keys.Alt('b')"}}, splitKeys("\x1b[15~\x1bb", keys.Mode{}))
+	assert.Equal(t, []keystroke{{expr: `keys.Text("\x1b[1;5C")`}}, splitKeys("\x1b[1;5C", keys.Mode{}))
+	assert.Equal(t, []keystroke{{text: "1"}, {expr: "keys.Keypad('1')"}}, splitKeys("1\x1bOq", keys.Mode{AppKeypad: true}))
+	assert.Equal(t, []keystroke{{expr: "keys.Escape"}}, splitKeys("\x1b", keys.Mode{}))
+	assert.Equal(t, []keystroke{{text: "ü"}, {expr: "keys.Tab"}, {expr: "keys.CtrlD"}}, splitKeys("ü\t\x04", keys.Mode{}))
+}
+
+func TestGenerate(t *testing.T) {
+	rec := &recording{
+		args: []string{"bash", "--norc"},
+		cols: 80,
+		rows: 30,
+		inputs: []input{
+			{anchor: "$", data: "e"},
+			// the echo of typed characters does not result in expectations
+			{anchor: "$ e", data: "cho \"hi\""},
+			{data: "x\x7f\r"},
+			{anchor: "$", data: "\x1b[A"},
+			{data: "\x1b[B"},
+			{anchor: "$ echo \"hi\"", data: "\x03"},
+			{anchor: "$", data: "\x04"},
+		},
+		final:    "exit",
+		exitCode: 0,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, generate(&buf, rec, "main_test", "TestBash"))
+	assert.Equal(t, `package main_test
+
+import (
+	"testing"
+
+	"github.com/ActiveState/termtest"
+	"github.com/ActiveState/termtest/keys"
+)
+
+// TestBash was recorded with termtest-record, review the expectations before you rely on it
+func TestBash(t *testing.T) {
+	cp, err := termtest.NewTest(t, termtest.Options{
+		CmdName: "bash",
+		Args:    []string{"--norc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp.Expect("$")
+	cp.SendUnterminated(`+"`echo \"hi\"`"+`)
+	cp.SendKeys(keys.Enter)
+	cp.Expect("$")
+	cp.SendKeys(keys.Up, keys.Down)
+	cp.Expect(`+"`$ echo \"hi\"`"+`)
+	cp.SendCtrlC()
+	cp.Expect("$")
+	cp.SendKeys(keys.CtrlD)
+	cp.Expect("exit")
+	cp.ExpectExitCode(0)
+}
+`, buf.String())
+}
+
+func TestGenerateTerminalSize(t *testing.T) {
+	rec := &recording{args: []string{"top"}, cols: 120, rows: 40, inputs: []input{{data: "q"}}, exitCode: -1}
+
+	var buf bytes.Buffer
+	require.NoError(t, generate(&buf, rec, "main_test", "TestTop"))
+	assert.Contains(t, buf.String(), `"github.com/ActiveState/termtest/expect"`)
+	assert.Contains(t, buf.String(), "ExtraOpts: []expect.ConsoleOpt{expect.WithTermCols(120), expect.WithTermRows(40)},")
+	assert.Contains(t, buf.String(), "cp.SendUnterminated(\"q\")\n\tcp.ExpectNotExitCode(0)\n")
+	assert.NotContains(t, buf.String(), `"github.com/ActiveState/termtest/keys"`)
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// Command termtest-record records an interactive session with a terminal application, and generates
+// the skeleton of a Go test that replays the session with termtest.
+//
+// The application runs in a pseudo-terminal that is connected to your terminal, so you can use it as
+// usual.  When it exits, the recorder writes the test:
+//
+//	termtest-record -o login_test.go -name TestLogin -- myapp login --user admin
+//
+// The test sends your input with SendUnterminated, SendKeys and SendCtrlC, such that it types the
+// same keys as you did, including Enter.  Before each input, it expects the last line of output that
+// the application printed since the previous input, which is usually a prompt.  Finally it expects
+// the exit code of the application.  The expectations are chosen heuristically, so review and refine
+// the test before you commit it.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var output = flag.String("o", "recorded_test.go", "write the generated test to this file")
+var testName = flag.String("name", "TestRecorded", "name of the generated test function")
+var pkgName = flag.String("package", "main_test", "package of the generated test file")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [--] command [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rec, err := record(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not record the session: %v\n", err)
+		os.Exit(1)
+	}
+
+	var buf bytes.Buffer
+	if err := generate(&buf, rec, *pkgName, *testName); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not generate the test: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s to %s\n", *testName, *output)
+}
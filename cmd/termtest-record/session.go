@@ -0,0 +1,169 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/ActiveState/termtest/conpty"
+	"github.com/ActiveState/termtest/keys"
+	"github.com/ActiveState/termtest/xpty"
+	"github.com/ActiveState/vt10x"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// session forwards the input of the user to the application and its output back to the user,
+// while recording both
+type session struct {
+	xp  *xpty.Xpty
+	rec *recording
+
+	mu sync.Mutex
+	// dirty is true if the application has printed output since the last input
+	dirty bool
+}
+
+// record runs the command in a pseudo-terminal that is connected to the terminal of the user until
+// the command exits
+func record(args []string) (*recording, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, errors.New("stdin is not a terminal")
+	}
+	cols, rows, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil || cols == 0 || rows == 0 {
+		cols, rows = 80, 30
+	}
+
+	// ENABLE_VIRTUAL_TERMINAL_PROCESSING on windows
+	reset, err := conpty.InitTerminal(false)
+	if err != nil {
+		return nil, err
+	}
+	defer reset()
+
+	xp, err := xpty.New(uint16(cols), uint16(rows), true)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := xp.StartProcessInTerminal(cmd); err != nil {
+		_ = xp.Close()
+		return nil, err
+	}
+	defer xp.CloseReaders()
+
+	oldState, err := terminal.MakeRaw(fd)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return nil, err
+	}
+	defer terminal.Restore(fd, oldState)
+
+	s := &session{
+		xp:  xp,
+		rec: &recording{args: args, cols: cols, rows: rows},
+	}
+	// the input goroutine stays blocked in the read from stdin after the command exits
+	go s.forwardInput(os.Stdin)
+
+	exited := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		// wait till passthrough-pipe has caught up
+		xp.WaitTillDrained()
+		_ = xp.CloseTTY()
+		exited <- err
+	}()
+	s.forwardOutput(os.Stdout)
+
+	err = <-exited
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		s.rec.exitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rec.final = s.anchor()
+	return s.rec, nil
+}
+
+// forwardInput sends the input of the user to the application, until reading from r fails
+func (s *session) forwardInput(r io.Reader) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.rec.inputs = append(s.rec.inputs, input{
+				anchor: s.anchor(),
+				data:   string(buf[:n]),
+				mode:   s.keyMode(),
+			})
+			s.dirty = false
+			s.mu.Unlock()
+
+			if _, err := s.xp.TerminalInPipe().Write(buf[:n]); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// forwardOutput copies the output of the application to w and to the virtual terminal, until the
+// pseudo-terminal is closed
+func (s *session) forwardOutput(w io.Writer) {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := s.xp.Read(buf)
+		if n > 0 {
+			_, _ = w.Write(buf[:n])
+
+			// the virtual terminal skips runes that are split between two reads
+			pending = append(pending, buf[:n]...)
+			k := xpty.CompleteRunes(pending)
+			s.mu.Lock()
+			_, _ = s.xp.Term.Write(pending[:k])
+			s.dirty = true
+			s.mu.Unlock()
+			pending = append(pending[:0], pending[k:]...)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// anchor returns the expectation for the output since the last input, or an empty string if there
+// has not been any output
+func (s *session) anchor() string {
+	if !s.dirty {
+		return ""
+	}
+	return anchorOf(s.xp.State.UnwrappedStringBeforeCursor())
+}
+
+// keyMode returns the terminal modes that are relevant for decoding key presses
+func (s *session) keyMode() keys.Mode {
+	st := s.xp.State
+	st.Lock()
+	defer st.Unlock()
+	return keys.Mode{
+		AppCursor: st.Mode(vt10x.ModeAppCursor),
+		AppKeypad: st.Mode(vt10x.ModeAppKeypad),
+	}
+}
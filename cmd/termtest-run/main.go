@@ -0,0 +1,122 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// Command termtest-run executes terminal scenarios written as scripts, and reports the result of each
+// step in the TAP or JUnit XML format.
+//
+// A script consists of one step per line, empty lines and lines starting with # are ignored:
+//
+//	# start a shell and greet the user
+//	timeout 5s
+//	env PS1='$ '
+//	spawn bash --norc
+//	expect "$ "
+//	sendline "echo hello $USER"
+//	expect-re timeout=2s 'hello (?P<name>\w+)'
+//	sendline "echo bye ${name}"
+//	expect "bye"
+//	key Ctrl+D
+//	expect-exit 0
+//
+// Arguments are separated by whitespace, and can be quoted like Go strings ("...") or raw ('...').
+// Options of the form name=value follow the command.  The only option is timeout, which
+// overrides the default timeout for the step; other arguments of that form are not options.
+// ${name} in arguments is replaced with the value of the variable or environment variable name.
+//
+// The steps are:
+//
+//	timeout <duration>        set the default timeout of the following steps (default: -timeout flag)
+//	set <name> <value>        set a variable
+//	env <NAME=value>          add an environment variable for the process
+//	cwd <dir>                 set the working directory of the process (default: script directory)
+//	spawn <cmd> [args...]     start the process in a pseudo-terminal
+//	send <text...>            send text
+//	sendline <text...>        send text followed by a newline
+//	key <key...>              send key presses like Enter, Up, F5, Ctrl+C or Alt+b
+//	expect <text...>          wait for text
+//	expect-re <pattern>       wait for a regular expression, named groups are stored in variables
+//	expect-exit <code>        wait for the process to exit with the exit code
+//	resize <cols> <rows>      resize the terminal
+//	signal <name>             send a signal like INT or TERM to the process
+//	snapshot <golden file>    compare the screen with a golden file (relative to the script)
+//	sleep <duration>          pause the script
+//
+// After a step fails, the remaining steps of the script are skipped.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var format = flag.String("format", "tap", "output format, tap or junit")
+var output = flag.String("o", "", "write the report to this file instead of stdout")
+var timeout = flag.Duration("timeout", 10*time.Second, "default timeout of the expect steps")
+var artifactsDir = flag.String("artifacts", "", "write the artifacts of failed scripts to sub-directories of this directory")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] script...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	code, err := run(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(code)
+}
+
+// run executes the scripts and returns the exit code of the command
+func run(paths []string) (int, error) {
+	var scripts []*script
+	for _, path := range paths {
+		s, err := parseFile(path)
+		if err != nil {
+			return 2, err
+		}
+		scripts = append(scripts, s)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return 2, err
+		}
+		defer f.Close()
+		w = f
+	}
+	var rep reporter
+	switch *format {
+	case "tap":
+		rep = newTAPReporter(w)
+	case "junit":
+		rep = newJUnitReporter(w)
+	default:
+		return 2, fmt.Errorf("unknown format %q", *format)
+	}
+
+	code := 0
+	for _, s := range scripts {
+		ok := newRunner(s, *timeout, *artifactsDir).run(func(res result) {
+			rep.result(s, res)
+		})
+		if !ok {
+			code = 1
+		}
+	}
+	if err := rep.close(); err != nil {
+		return 2, err
+	}
+	return code, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// reporter writes the results of the steps of one or more scripts
+type reporter interface {
+	// result reports the outcome of a step of script s
+	result(s *script, res result)
+	// close finishes the report
+	close() error
+}
+
+// tapReporter writes the results in the Test Anything Protocol (version 13) as they come in
+type tapReporter struct {
+	w io.Writer
+	n int
+}
+
+func newTAPReporter(w io.Writer) *tapReporter {
+	fmt.Fprintln(w, "TAP version 13")
+	return &tapReporter{w: w}
+}
+
+func (r *tapReporter) result(s *script, res result) {
+	r.n++
+	desc := fmt.Sprintf("%s:%d %s", s.name, res.step.line, res.step.text)
+	switch {
+	case res.skipped:
+		fmt.Fprintf(r.w, "ok %d - %s # SKIP a previous step failed\n", r.n, desc)
+	case res.err == nil:
+		fmt.Fprintf(r.w, "ok %d - %s\n", r.n, desc)
+	default:
+		fmt.Fprintf(r.w, "not ok %d - %s\n", r.n, desc)
+		fmt.Fprintln(r.w, "  ---")
+		fmt.Fprintf(r.w, "  message: %q\n", res.err.Error())
+		fmt.Fprintf(r.w, "  duration_ms: %d\n", res.duration.Milliseconds())
+		if res.screen != "" {
+			fmt.Fprintln(r.w, "  screen: |")
+			for _, line := range strings.Split(strings.TrimRight(res.screen, "\n"), "\n") {
+				fmt.Fprintf(r.w, "    %s\n", line)
+			}
+		}
+		fmt.Fprintln(r.w, "  ...")
+	}
+}
+
+func (r *tapReporter) close() error {
+	_, err := fmt.Fprintf(r.w, "1..%d\n", r.n)
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+	seconds  float64
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReporter writes the results as JUnit XML, with a test suite per script and a test case per step
+type junitReporter struct {
+	w      io.Writer
+	suites []junitTestSuite
+}
+
+func newJUnitReporter(w io.Writer) *junitReporter {
+	return &junitReporter{w: w}
+}
+
+func (r *junitReporter) result(s *script, res result) {
+	if len(r.suites) == 0 || r.suites[len(r.suites)-1].Name != s.name {
+		r.suites = append(r.suites, junitTestSuite{Name: s.name})
+	}
+	suite := &r.suites[len(r.suites)-1]
+
+	tc := junitTestCase{
+		Name:      fmt.Sprintf("%d: %s", res.step.line, res.step.text),
+		ClassName: s.name,
+		Time:      fmt.Sprintf("%.3f", res.duration.Seconds()),
+	}
+	switch {
+	case res.skipped:
+		tc.Skipped = &junitSkipped{Message: "a previous step failed"}
+		suite.Skipped++
+	case res.err != nil:
+		tc.Failure = &junitFailure{Message: res.err.Error(), Text: res.err.Error()}
+		if res.screen != "" {
+			tc.Failure.Text += "\n\nTerminal screen:\n" + res.screen
+		}
+		suite.Failures++
+	}
+	suite.Tests++
+	suite.seconds += res.duration.Seconds()
+	suite.Time = fmt.Sprintf("%.3f", suite.seconds)
+	suite.Cases = append(suite.Cases, tc)
+}
+
+func (r *junitReporter) close() error {
+	if _, err := io.WriteString(r.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(r.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: r.suites}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.w, "\n")
+	return err
+}
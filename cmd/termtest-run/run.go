@@ -0,0 +1,254 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ActiveState/termtest"
+	"github.com/ActiveState/termtest/keys"
+)
+
+// result is the outcome of a step
+type result struct {
+	step     *step
+	err      error
+	skipped  bool
+	duration time.Duration
+	// screen is the terminal screen after a failed step
+	screen string
+}
+
+// runner executes the steps of a script
+type runner struct {
+	script       *script
+	timeout      time.Duration
+	artifactsDir string
+
+	vars map[string]string
+	env  []string
+	cwd  string
+	cp   *termtest.ConsoleProcess
+}
+
+func newRunner(s *script, timeout time.Duration, artifactsDir string) *runner {
+	return &runner{
+		script:       s,
+		timeout:      timeout,
+		artifactsDir: artifactsDir,
+		vars:         make(map[string]string),
+		cwd:          filepath.Dir(s.name),
+	}
+}
+
+// run executes all steps and reports their results to report
+// After a step fails, the remaining steps are skipped.
+func (r *runner) run(report func(result)) bool {
+	defer func() {
+		if r.cp != nil {
+			_ = r.cp.Close()
+		}
+	}()
+
+	ok := true
+	for _, st := range r.script.steps {
+		if !ok {
+			report(result{step: st, skipped: true})
+			continue
+		}
+
+		start := time.Now()
+		err := r.exec(st)
+		res := result{step: st, err: err, duration: time.Since(start)}
+		if err != nil {
+			ok = false
+			if r.cp != nil {
+				res.screen = trimScreen(r.cp.Snapshot())
+				r.writeArtifacts()
+			}
+		}
+		report(res)
+	}
+	return ok
+}
+
+// writeArtifacts writes the artifacts of the terminal session to a sub-directory of the artifacts
+// directory named after the script
+func (r *runner) writeArtifacts() {
+	if r.artifactsDir == "" {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(r.script.name), filepath.Ext(r.script.name))
+	dir := filepath.Join(r.artifactsDir, name)
+	if err := r.cp.WriteArtifacts(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write artifacts: %v\n", err)
+	}
+}
+
+func (r *runner) exec(st *step) error {
+	args := make([]string, len(st.args))
+	for i, arg := range st.args {
+		var err error
+		if args[i], err = r.expand(arg); err != nil {
+			return err
+		}
+	}
+	timeout := r.timeout
+	if st.timeout > 0 {
+		timeout = st.timeout
+	}
+
+	if r.cp == nil {
+		switch st.cmd {
+		case "timeout", "set", "env", "cwd", "spawn", "sleep":
+		default:
+			return errors.New("no process has been spawned")
+		}
+	}
+
+	switch st.cmd {
+	case "timeout":
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		r.timeout = d
+	case "set":
+		r.vars[args[0]] = args[1]
+	case "env":
+		if !strings.Contains(args[0], "=") {
+			return fmt.Errorf("environment variable %q is not of the form NAME=value", args[0])
+		}
+		r.env = append(r.env, args[0])
+	case "cwd":
+		r.cwd = args[0]
+	case "spawn":
+		return r.spawn(args)
+	case "send":
+		r.cp.SendUnterminated(strings.Join(args, " "))
+	case "sendline":
+		r.cp.SendLine(strings.Join(args, " "))
+	case "key":
+		var ks []keys.Key
+		for _, arg := range args {
+			k, err := keys.Parse(arg)
+			if err != nil {
+				return err
+			}
+			ks = append(ks, k)
+		}
+		r.cp.SendKeys(ks...)
+	case "expect":
+		_, err := r.cp.Expect(strings.Join(args, " "), timeout)
+		return err
+	case "expect-re":
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			return err
+		}
+		m, err := r.cp.ExpectReSubmatch(args[0], timeout)
+		if err != nil {
+			return err
+		}
+		for i, name := range re.SubexpNames() {
+			if name != "" && m.Groups[i] != "" {
+				r.vars[name] = m.Groups[i]
+			}
+		}
+	case "expect-exit":
+		code, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid exit code: %w", err)
+		}
+		_, err = r.cp.ExpectExitCode(code, timeout)
+		return err
+	case "resize":
+		cols, err := strconv.ParseUint(args[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid number of columns: %w", err)
+		}
+		rows, err := strconv.ParseUint(args[1], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid number of rows: %w", err)
+		}
+		return r.cp.Resize(uint16(cols), uint16(rows))
+	case "signal":
+		sig, ok := signals[strings.TrimPrefix(strings.ToUpper(args[0]), "SIG")]
+		if !ok {
+			return fmt.Errorf("unknown signal %q", args[0])
+		}
+		return r.cp.Signal(sig)
+	case "snapshot":
+		golden := args[0]
+		if !filepath.IsAbs(golden) {
+			golden = filepath.Join(filepath.Dir(r.script.name), golden)
+		}
+		return r.cp.ExpectSnapshot(golden)
+	case "sleep":
+		d, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		time.Sleep(d)
+	}
+	return nil
+}
+
+func (r *runner) spawn(args []string) error {
+	if r.cp != nil {
+		return errors.New("a process has already been spawned")
+	}
+	cp, err := termtest.New(termtest.Options{
+		DefaultTimeout: r.timeout,
+		WorkDirectory:  r.cwd,
+		RetainWorkDir:  true,
+		Environment:    append(os.Environ(), r.env...),
+		CmdName:        args[0],
+		Args:           args[1:],
+		// stdout only contains the report
+		LogWriter: os.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+	r.cp = cp
+	return nil
+}
+
+// trimScreen removes trailing spaces and empty lines from a terminal screen
+func trimScreen(screen string) string {
+	lines := strings.Split(screen, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+var varRe = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// expand replaces ${name} with the value of the variable name, variables are set by the set step
+// and by named groups in expect-re steps.  Environment variables are used as a fallback.
+func (r *runner) expand(s string) (string, error) {
+	var err error
+	res := varRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := varRe.FindStringSubmatch(ref)[1]
+		if v, ok := r.vars[name]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+		err = fmt.Errorf("undefined variable %q", name)
+		return ref
+	})
+	return res, err
+}
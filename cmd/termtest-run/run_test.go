@@ -0,0 +1,103 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeScripts builds the tester command and writes a script that passes and one that fails to dir
+func writeScripts(t *testing.T, dir string) (passing string, failing string) {
+	tester := filepath.Join(dir, "tester")
+	if runtime.GOOS == "windows" {
+		tester += ".exe"
+	}
+	out, err := exec.Command("go", "build", "-o", tester, "../tester").CombinedOutput()
+	require.NoError(t, err, "build tester: %s", out)
+
+	passing = filepath.Join(dir, "passing.txt")
+	require.NoError(t, ioutil.WriteFile(passing, []byte(`
+spawn '`+tester+`' -prompts 1
+expect-re 'Overwrite file(?P<n>\d+)\.txt\? \[y/N\] '
+sendline y
+expect "overwrote ${n} files"
+expect-exit 0
+`), 0644))
+
+	failing = filepath.Join(dir, "failing.txt")
+	require.NoError(t, ioutil.WriteFile(failing, []byte(`
+spawn '`+tester+`'
+expect timeout=200ms "never printed"
+expect-exit 0
+`), 0644))
+	return passing, failing
+}
+
+// runReport runs the scripts and returns the exit code and the report in the format f
+func runReport(t *testing.T, f string, scripts ...string) (int, string) {
+	report := filepath.Join(filepath.Dir(scripts[0]), "report."+f)
+	oldFormat, oldOutput := *format, *output
+	*format, *output = f, report
+	defer func() { *format, *output = oldFormat, oldOutput }()
+
+	code, err := run(scripts)
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(report)
+	require.NoError(t, err)
+	return code, string(b)
+}
+
+func TestRunTAP(t *testing.T) {
+	passing, failing := writeScripts(t, t.TempDir())
+
+	code, report := runReport(t, "tap", passing, failing)
+	assert.Equal(t, 1, code)
+	assert.Regexp(t, `^TAP version 13\n`, report)
+	assert.Contains(t, report, "ok 1 - "+passing+":2 spawn '")
+	assert.Contains(t, report, "ok 5 - "+passing+":6 expect-exit 0\n")
+	assert.Contains(t, report, "not ok 7 - "+failing+`:3 expect timeout=200ms "never printed"`+"\n")
+	assert.Contains(t, report, `  message: "timed out after`)
+	assert.Contains(t, report, "  screen: |\n    an expected string\n")
+	assert.Contains(t, report, "ok 8 - "+failing+":4 expect-exit 0 # SKIP a previous step failed\n")
+	assert.Regexp(t, `\n1\.\.8\n$`, report)
+
+	code, _ = runReport(t, "tap", passing)
+	assert.Equal(t, 0, code)
+}
+
+func TestRunJUnit(t *testing.T) {
+	passing, failing := writeScripts(t, t.TempDir())
+
+	code, report := runReport(t, "junit", passing, failing)
+	assert.Equal(t, 1, code)
+
+	var res junitTestSuites
+	require.NoError(t, xml.Unmarshal([]byte(report), &res))
+	require.Len(t, res.Suites, 2)
+
+	assert.Equal(t, passing, res.Suites[0].Name)
+	assert.Equal(t, 5, res.Suites[0].Tests)
+	assert.Equal(t, 0, res.Suites[0].Failures)
+
+	suite := res.Suites[1]
+	assert.Equal(t, failing, suite.Name)
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	require.Len(t, suite.Cases, 3)
+	assert.Nil(t, suite.Cases[0].Failure)
+	require.NotNil(t, suite.Cases[1].Failure)
+	assert.Contains(t, suite.Cases[1].Failure.Message, "timed out after")
+	assert.Contains(t, suite.Cases[1].Failure.Text, "Terminal screen:\nan expected string")
+	assert.NotNil(t, suite.Cases[2].Skipped)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// script is a parsed scenario file
+type script struct {
+	name  string
+	steps []*step
+}
+
+// step is a single line of a script
+type step struct {
+	line    int
+	text    string // the line as written in the script
+	cmd     string
+	args    []string
+	timeout time.Duration // zero if the step uses the default timeout
+}
+
+// arity is the number of arguments of the commands, -1 means at least one
+var arity = map[string]int{
+	"timeout":     1,
+	"set":         2,
+	"env":         1,
+	"cwd":         1,
+	"spawn":       -1,
+	"send":        -1,
+	"sendline":    -1,
+	"key":         -1,
+	"expect":      -1,
+	"expect-re":   1,
+	"expect-exit": 1,
+	"resize":      2,
+	"signal":      1,
+	"snapshot":    1,
+	"sleep":       1,
+}
+
+func parseFile(path string) (*script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseScript(path, f)
+}
+
+// parseScript parses a script with one step per line
+// Lines starting with # are comments.  A step consists of a command, options of the form
+// name=value and the arguments, which can be quoted like Go strings ("...") or raw ('...').
+func parseScript(name string, r io.Reader) (*script, error) {
+	s := &script{name: name}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		st, err := parseStep(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		st.line = n
+		s.steps = append(s.steps, st)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseStep(text string) (*step, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	st := &step{text: text, cmd: tokens[0].value}
+	n, ok := arity[st.cmd]
+	if tokens[0].quoted || !ok {
+		return nil, fmt.Errorf("unknown command %q", tokens[0].value)
+	}
+
+	// arguments that look like options of other names are text, e.g., "expect a=b"
+	args := tokens[1:]
+	for len(args) > 0 && !args[0].quoted && st.cmd != "set" && st.cmd != "env" {
+		kv := strings.SplitN(args[0].value, "=", 2)
+		if len(kv) != 2 || kv[0] != "timeout" {
+			break
+		}
+		if st.timeout, err = time.ParseDuration(kv[1]); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		args = args[1:]
+	}
+	for _, arg := range args {
+		st.args = append(st.args, arg.value)
+	}
+
+	switch {
+	case n < 0 && len(st.args) == 0:
+		return nil, fmt.Errorf("%s requires at least one argument", st.cmd)
+	case n >= 0 && len(st.args) != n:
+		return nil, fmt.Errorf("%s requires %d argument(s), got %d", st.cmd, n, len(st.args))
+	}
+	return st, nil
+}
+
+type token struct {
+	value  string
+	quoted bool
+}
+
+// tokenize splits a line into whitespace-separated tokens like a shell does.  Double-quoted parts
+// of a token are unquoted like Go string literals, single-quoted parts are taken verbatim.
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	for {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return tokens, nil
+		}
+
+		var tok token
+		var sb strings.Builder
+		for text != "" && !unicode.IsSpace(rune(text[0])) {
+			switch text[0] {
+			case '"':
+				end := 1
+				for ; end < len(text) && text[end] != '"'; end++ {
+					if text[end] == '\\' {
+						end++
+					}
+				}
+				if end >= len(text) {
+					return nil, fmt.Errorf("unterminated string %s", text)
+				}
+				value, err := strconv.Unquote(text[:end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %s: %w", text[:end+1], err)
+				}
+				sb.WriteString(value)
+				tok.quoted = true
+				text = text[end+1:]
+			case '\'':
+				end := strings.IndexByte(text[1:], '\'')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated string %s", text)
+				}
+				sb.WriteString(text[1 : end+1])
+				tok.quoted = true
+				text = text[end+2:]
+			default:
+				end := strings.IndexFunc(text, func(r rune) bool { return unicode.IsSpace(r) || r == '"' || r == '\'' })
+				if end < 0 {
+					end = len(text)
+				}
+				sb.WriteString(text[:end])
+				text = text[end:]
+			}
+		}
+		tok.value = sb.String()
+		tokens = append(tokens, tok)
+	}
+}
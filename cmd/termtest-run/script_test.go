@@ -0,0 +1,69 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScript(t *testing.T) {
+	s, err := parseScript("test.txt", strings.NewReader(`
+# a comment
+env PS1='$ '
+spawn bash --norc
+expect timeout=2s "hello\tworld"
+expect-re 'id=(?P<id>\d+)'
+sendline echo "${id}"
+expect retries=3 done
+`))
+	require.NoError(t, err)
+	require.Len(t, s.steps, 6)
+
+	assert.Equal(t, &step{line: 3, text: "env PS1='$ '", cmd: "env", args: []string{"PS1=$ "}}, s.steps[0])
+	assert.Equal(t, []string{"bash", "--norc"}, s.steps[1].args)
+	assert.Equal(t, []string{"hello\tworld"}, s.steps[2].args)
+	assert.Equal(t, 2*time.Second, s.steps[2].timeout)
+	assert.Equal(t, []string{`id=(?P<id>\d+)`}, s.steps[3].args)
+	assert.Equal(t, 7, s.steps[4].line)
+	assert.Equal(t, []string{"echo", "${id}"}, s.steps[4].args)
+	// only known options are parsed, other arguments of the same form are text
+	assert.Equal(t, []string{"retries=3", "done"}, s.steps[5].args)
+	assert.Equal(t, time.Duration(0), s.steps[5].timeout)
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown command":  "launch bash",
+		"missing argument": "expect",
+		"extra argument":   "resize 80 24 1",
+		"invalid timeout":  "expect timeout=soon foo",
+		"unterminated":     `expect "foo`,
+		"invalid escape":   `expect "\d"`,
+	}
+	for name, script := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseScript("test.txt", strings.NewReader(script))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "test.txt:1: ")
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	r := newRunner(&script{name: "test.txt"}, time.Second, "")
+	r.vars["port"] = "8080"
+
+	res, err := r.expand("localhost:${port}")
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:8080", res)
+
+	_, err = r.expand("${termtest_undefined_variable}")
+	assert.Error(t, err)
+}
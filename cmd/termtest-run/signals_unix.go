@@ -0,0 +1,27 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals maps the names of the signals that the signal step can send to them
+var signals = map[string]os.Signal{
+	"INT":   syscall.SIGINT,
+	"TERM":  syscall.SIGTERM,
+	"HUP":   syscall.SIGHUP,
+	"QUIT":  syscall.SIGQUIT,
+	"KILL":  syscall.SIGKILL,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+	"CONT":  syscall.SIGCONT,
+	"STOP":  syscall.SIGSTOP,
+	"TSTP":  syscall.SIGTSTP,
+}
@@ -0,0 +1,17 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// signals maps the names of the signals that the signal step can send to them
+var signals = map[string]os.Signal{
+	"INT":  os.Interrupt,
+	"KILL": os.Kill,
+}
@@ -5,17 +5,27 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"syscall"
 	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 var exit1 = flag.Bool("exit1", false, "exit the script with exit code 1")
 var sleep = flag.Bool("sleep", false, "sleep for an hour, basically never return unless interrupted")
 var fillBuffer = flag.Bool("fill-buffer", false, "print a string with 100,00 characters")
 var stutter = flag.Bool("stutter", false, "print 50 messages with 50 ms delays")
+var readKeys = flag.Bool("read-keys", false, "enable application cursor mode, read a line and print it quoted")
+var spawnChild = flag.Bool("spawn-child", false, "start a child process that ignores SIGTERM and sleeps, and exit without waiting for it")
+var ignoreTerm = flag.Bool("ignore-term", false, "ignore SIGTERM and SIGHUP signals, like a daemon")
+var winch = flag.Bool("winch", false, "print the terminal size after each of two resizes")
+var prompts = flag.Int("prompts", 0, "ask to overwrite the given number of files, and abort unless all are confirmed")
 
 func main() {
 	c := make(chan os.Signal, 1)
@@ -24,8 +34,27 @@ func main() {
 
 	flag.Parse()
 
+	if *ignoreTerm {
+		signal.Ignore(syscall.SIGTERM, syscall.SIGHUP)
+	}
+
 	fmt.Println("an expected string")
 
+	if *spawnChild {
+		child := exec.Command(os.Args[0], "-ignore-term", "-sleep")
+		out, err := child.StdoutPipe()
+		if err == nil {
+			err = child.Start()
+		}
+		if err != nil {
+			fmt.Printf("failed to start child: %v\n", err)
+			os.Exit(1)
+		}
+		// the child ignores signals once it has printed its first line
+		_, _ = bufio.NewReader(out).ReadString('\n')
+		fmt.Printf("started child %d\n", child.Process.Pid)
+	}
+
 	if *sleep {
 		/* This will listen to a ctrl-c event for up to two hours
 		 * Notice: That it is *only* necessary to watch for an interrupt
@@ -59,6 +88,42 @@ func main() {
 		}
 	}
 
+	if *readKeys {
+		// enable application cursor keys (DECCKM)
+		fmt.Print("\033[?1h")
+		fmt.Println("waiting for keys")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		fmt.Printf("received keys: %q\n", line)
+	}
+
+	if *prompts > 0 {
+		stdin := bufio.NewReader(os.Stdin)
+		for i := 0; i < *prompts; i++ {
+			fmt.Printf("Overwrite file%d.txt? [y/N] ", i+1)
+			line, _ := stdin.ReadString('\n')
+			if line != "y\n" && line != "y\r\n" {
+				fmt.Println("aborted")
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("overwrote %d files\n", *prompts)
+	}
+
+	if *winch {
+		resized := make(chan os.Signal, 1)
+		notifyResize(resized)
+		fmt.Println("waiting for resize")
+		for i := 0; i < 2; i++ {
+			<-resized
+			cols, rows, err := terminal.GetSize(int(os.Stdout.Fd()))
+			if err != nil {
+				fmt.Printf("failed to get size: %v\n", err)
+				continue
+			}
+			fmt.Printf("resized to %dx%d\n", cols, rows)
+		}
+	}
+
 	if *exit1 {
 		os.Exit(1)
 	}
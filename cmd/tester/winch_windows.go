@@ -0,0 +1,14 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// notifyResize does nothing, as Windows does not signal changes of the terminal size
+func notifyResize(c chan<- os.Signal) {}
@@ -9,18 +9,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
-	"syscall"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ActiveState/termtest/expect"
 	"github.com/ActiveState/termtest/internal/osutils"
+	"github.com/ActiveState/termtest/keys"
+	"github.com/ActiveState/vt10x"
 )
 
 var (
@@ -37,6 +41,10 @@ func (errWaitTimeout) Timeout() bool { return true }
 // ErrWaitTimeout is returned when we time out waiting for the console process to exit
 var ErrWaitTimeout = errWaitTimeout{fmt.Errorf("timeout waiting for exit code")}
 
+// testDeadlineGrace is the time before the test deadline at which NewTest cancels the ConsoleProcess,
+// such that the failure can still be reported before the test binary panics
+const testDeadlineGrace = 2 * time.Second
+
 // ConsoleProcess bonds a command with a pseudo-terminal for automation
 type ConsoleProcess struct {
 	opts    Options
@@ -46,21 +54,157 @@ type ConsoleProcess struct {
 	cmdName string
 	ctx     context.Context
 	cancel  func()
+	cast    *castRecorder
+	// shell tracks the prompt and the commands of a shell with shell integration
+	shell *shellMarkers
+
+	// report collects the information written by WriteArtifacts
+	report    *failureReport
+	cmdString string
+	exited    chan struct{} // closed when the process has exited
+	waited    chan struct{} // closed when the exit status has been received by wait()
+	started   time.Time
+	ended     time.Time // set when the process has exited
+
+	terminateOnce sync.Once
 }
 
 // NewTest bonds a command process with a console pty and sets it up for testing
-func NewTest(t *testing.T, opts Options) (*ConsoleProcess, error) {
-	opts.ObserveExpect = TestExpectObserveFn(t)
+// If opts.CastFile is not set, the terminal session is recorded to a temporary asciicast file
+// that is kept and reported when the test fails.
+// When the test fails, the artifacts of the terminal session (see WriteArtifacts) are written to
+// opts.ArtifactsDir, a sub-directory of $TERMTEST_ARTIFACTS_DIR or the temporary directory of the
+// test, and the test log points at them.
+// If the test has a deadline, the process is killed and all pending expectations fail shortly before it.
+// The ConsoleProcess is closed when the test ends, and the test log reports if the process was still
+// running or its exit code has not been checked at that time.
+func NewTest(t testing.TB, opts Options) (*ConsoleProcess, error) {
+	var cp *ConsoleProcess
+	var artifactsDir string
+	// the artifacts are written on the first failure, and updated when the test ends
+	writeArtifacts := func() {
+		dir := artifactsDir
+		if dir == "" {
+			dir = testArtifactsDir(t, opts)
+		}
+		if err := cp.WriteArtifacts(dir); err != nil {
+			t.Logf("Could not write test artifacts: %v", err)
+			return
+		}
+		if artifactsDir == "" {
+			artifactsDir = dir
+			t.Logf("Test artifacts written to %s", dir)
+		}
+	}
+
+	opts.ObserveExpect = func(matchers []expect.Matcher, ms *expect.MatchState, err error) {
+		if err == nil {
+			return
+		}
+		writeArtifacts()
+		if artifactsDir == "" {
+			TestExpectObserveFn(t)(matchers, ms, err)
+			return
+		}
+		t.Fatalf(
+			"Could not meet expectation: Expectation: '%s'\nError: %v\nSee %s for the screen and %s for the expectation\n",
+			strings.Join(expect.CriteriaStrings(matchers), ", "), err,
+			filepath.Join(artifactsDir, ArtifactScreen), filepath.Join(artifactsDir, ArtifactExpectation),
+		)
+	}
 	opts.ObserveSend = TestSendObserveFn(t)
-	return New(opts)
+
+	ctx := context.Background()
+	// only tests, but not benchmarks have a deadline
+	if dt, ok := t.(interface{ Deadline() (time.Time, bool) }); ok {
+		if deadline, ok := dt.Deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline.Add(-testDeadlineGrace))
+			t.Cleanup(cancel)
+		}
+	}
+
+	tmpCast := ""
+	if opts.CastFile == "" {
+		f, err := ioutil.TempFile("", strings.ReplaceAll(sanitizeFileName(t.Name()), "/", "_")+"-*.cast")
+		if err != nil {
+			return nil, err
+		}
+		_ = f.Close()
+		tmpCast = f.Name()
+		opts.CastFile = tmpCast
+	}
+
+	var err error
+	cp, err = NewWithContext(ctx, opts)
+	if err != nil {
+		if tmpCast != "" {
+			_ = os.Remove(tmpCast)
+		}
+		return nil, err
+	}
+
+	t.Cleanup(func() {
+		// waited is closed after exited, so it has to be checked on its own first
+		select {
+		case <-cp.waited:
+		default:
+			select {
+			case <-cp.exited:
+				t.Logf("ExpectExitCode never called: the exit code of '%s' has not been checked", cp.cmdString)
+			default:
+				t.Logf("Process still running: '%s' is killed at the end of the test", cp.cmdString)
+			}
+		}
+		if opts.CheckLeakedProcesses {
+			if leaked, err := cp.LeftoverProcesses(); err != nil {
+				t.Logf("Could not check for leaked processes: %v", err)
+			} else if len(leaked) > 0 {
+				t.Errorf("Processes started by '%s' are still running and are killed at the end of the test:\n%s", cp.cmdString, strings.Join(leaked, "\n"))
+			}
+		}
+		_ = cp.Close()
+
+		if t.Failed() {
+			writeArtifacts()
+			t.Logf("Terminal session recorded to %s (replay with `asciinema play %s`)", opts.CastFile, opts.CastFile)
+			return
+		}
+		if tmpCast != "" {
+			_ = os.Remove(tmpCast)
+		}
+	})
+	return cp, nil
 }
 
 // New bonds a command process with a console pty.
 func New(opts Options) (*ConsoleProcess, error) {
+	return NewWithContext(context.Background(), opts)
+}
+
+// NewWithContext bonds a command process with a console pty.
+// When ctx is done, the process is killed and all pending expectations return the context's error.
+func NewWithContext(ctx context.Context, opts Options) (*ConsoleProcess, error) {
 	if err := opts.Normalize(); err != nil {
 		return nil, err
 	}
 
+	// remove the work directory and the shell configuration if the process cannot be started
+	cleanUp := true
+	defer func() {
+		if cleanUp {
+			_ = opts.CleanUp()
+		}
+	}()
+
+	var shell *shellMarkers
+	if opts.ShellIntegration {
+		if err := setupShellIntegration(&opts); err != nil {
+			return nil, err
+		}
+		shell = &shellMarkers{}
+	}
+
 	cmd := exec.Command(opts.CmdName, opts.Args...)
 	cmd.Dir = opts.WorkDirectory
 	cmd.Env = opts.Environment
@@ -73,26 +217,63 @@ func New(opts Options) (*ConsoleProcess, error) {
 	if opts.HideCmdLine {
 		cmdString = "*****"
 	}
-	fmt.Printf("Spawning '%s' from %s\n", cmdString, opts.WorkDirectory)
+	fmt.Fprintf(opts.LogWriter, "Spawning '%s' from %s\n", cmdString, opts.WorkDirectory)
 
+	// the report has to observe errors before the observers that stop the test
+	report := newFailureReport(opts.MaxArtifactBytes)
 	conOpts := []expect.ConsoleOpt{
 		expect.WithDefaultTimeout(opts.DefaultTimeout),
+		expect.WithStdout(report),
+		expect.WithSendObserver(report.observeSend),
+		expect.WithExpectObserver(report.observeExpect),
 		expect.WithSendObserver(expect.SendObserver(opts.ObserveSend)),
 		expect.WithExpectObserver(opts.ObserveExpect),
+		expect.WithHistoryLimit(opts.MaxHistoryLines, opts.MaxHistoryBytes),
 	}
 	conOpts = append(conOpts, opts.ExtraOpts...)
+	if shell != nil {
+		conOpts = append(conOpts, expect.WithStdout(shell))
+	}
+
+	var cast *castRecorder
+	if opts.CastFile != "" {
+		var err error
+		cast, err = createCastRecorder(opts.CastFile)
+		if err != nil {
+			return nil, err
+		}
+		conOpts = append(conOpts, expect.WithStdout(cast), expect.WithSendObserver(cast.observeSend))
+	}
 
 	console, err := expect.NewConsole(conOpts...)
+	if err == nil && console.Pty == nil {
+		_ = console.Close()
+		err = errors.New("the process has to run in a pseudo-terminal, other console backends are not supported")
+	}
 
 	if err != nil {
+		if cast != nil {
+			_ = cast.Close()
+		}
 		return nil, err
 	}
 
+	if cast != nil {
+		rows, cols := console.Pty.State.Size()
+		cast.begin(cols, rows, cmdString, castEnv(opts.Environment))
+	}
+
 	if err = console.Pty.StartProcessInTerminal(cmd); err != nil {
+		_ = console.Close()
+		if cast != nil {
+			_ = cast.Close()
+		}
 		return nil, err
 	}
+	cleanUp = false
+	started := time.Now()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 
 	cp := ConsoleProcess{
 		opts:    opts,
@@ -102,6 +283,14 @@ func New(opts Options) (*ConsoleProcess, error) {
 		cmdName: opts.CmdName,
 		ctx:     ctx,
 		cancel:  cancel,
+		cast:    cast,
+		shell:   shell,
+
+		report:    report,
+		cmdString: cmdString,
+		exited:    make(chan struct{}),
+		waited:    make(chan struct{}),
+		started:   started,
 	}
 
 	// Asynchronously wait for the underlying process to finish and communicate
@@ -111,11 +300,13 @@ func New(opts Options) (*ConsoleProcess, error) {
 		defer close(cp.errs)
 
 		err := cmd.Wait()
+		cp.ended = time.Now()
+		close(cp.exited)
 
 		select {
 		case cp.errs <- err:
+			close(cp.waited)
 		case <-cp.ctx.Done():
-			log.Println("ConsoleProcess cancelled!  You may have forgotten to call ExpectExitCode()")
 			_ = console.Close()
 			return
 		}
@@ -125,29 +316,71 @@ func New(opts Options) (*ConsoleProcess, error) {
 		_ = console.Pty.CloseTTY()
 	}()
 
+	// Kill the process if the context is done before it exits
+	go func() {
+		select {
+		case <-cp.ctx.Done():
+			cp.terminate()
+		case <-cp.exited:
+		}
+	}()
+
 	return &cp, nil
 }
 
 // Close cleans up all the resources allocated by the ConsoleProcess
-// If the underlying process is still running, it is terminated with a SIGTERM signal.
+// The underlying process, if it is still running, and all processes that it has started in its
+// session are terminated with a SIGTERM signal, and killed if they are still running after
+// Options.KillGracePeriod.
 func (cp *ConsoleProcess) Close() error {
 	cp.cancel()
 
 	_ = cp.opts.CleanUp()
 
-	if cp.cmd == nil || cp.cmd.Process == nil {
-		return nil
+	if cp.cast != nil {
+		_ = cp.cast.Close()
 	}
 
-	if cp.cmd.ProcessState != nil && cp.cmd.ProcessState.Exited() {
+	if cp.cmd == nil || cp.cmd.Process == nil {
 		return nil
 	}
 
-	if err := cp.cmd.Process.Kill(); err == nil {
-		return nil
-	}
+	cp.terminate()
+	return nil
+}
+
+// terminate terminates the process and all processes that it has started in its session, giving
+// them the grace period to exit after a SIGTERM signal
+// Only the first call terminates the session, later calls wait until it is terminated.
+func (cp *ConsoleProcess) terminate() {
+	cp.terminateOnce.Do(func() {
+		err := osutils.TerminateSession(cp.cmd.Process.Pid, cp.opts.KillGracePeriod)
+		select {
+		case <-cp.exited:
+			return
+		default:
+		}
+		if err != nil {
+			_ = cp.cmd.Process.Kill()
+		}
+	})
+}
 
-	return cp.cmd.Process.Signal(syscall.SIGTERM)
+// LeftoverProcesses returns the process ids and command lines of the processes that the process
+// under test has started in its session (or process group on MacOS) and that are still running
+// It is not supported on Windows.
+func (cp *ConsoleProcess) LeftoverProcesses() ([]string, error) {
+	procs, err := osutils.SessionProcesses(cp.cmd.Process.Pid)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, p := range procs {
+		if p.Pid != cp.cmd.Process.Pid {
+			res = append(res, p.String())
+		}
+	}
+	return res, nil
 }
 
 // Executable returns the command name to be executed
@@ -160,6 +393,12 @@ func (cp *ConsoleProcess) Cmd() *exec.Cmd {
 	return cp.cmd
 }
 
+// Exited returns a channel that is closed when the process has exited
+// Once it is closed, Cmd().ProcessState can be read safely.
+func (cp *ConsoleProcess) Exited() <-chan struct{} {
+	return cp.exited
+}
+
 // WorkDirectory returns the directory in which the command shall be run
 func (cp *ConsoleProcess) WorkDirectory() string {
 	return cp.opts.WorkDirectory
@@ -186,12 +425,44 @@ func (cp *ConsoleProcess) TrimmedSnapshot() string {
 // a timeout occurs
 // Default timeout is 10 seconds
 func (cp *ConsoleProcess) ExpectRe(value string, timeout ...time.Duration) (string, error) {
-	opts := []expect.ExpectOpt{expect.RegexpPattern(value)}
+	return cp.ExpectReContext(cp.ctx, value, timeout...)
+}
+
+// ExpectReContext is like ExpectRe, but it also returns the context's error as soon as ctx is done
+func (cp *ConsoleProcess) ExpectReContext(ctx context.Context, value string, timeout ...time.Duration) (string, error) {
+	return cp.expectContext(ctx, expect.RegexpPattern(value), timeout...)
+}
+
+// ExpectReSubmatch is like ExpectRe, but it returns the text of the match and its capture groups,
+// e.g., to use a value printed by the program in a follow-up Send call
+// The regular expression is matched against the output with the automatic line wraps removed.
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectReSubmatch(value string, timeout ...time.Duration) (*expect.RegexpMatch, error) {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, err
+	}
+	var m expect.RegexpMatch
+	opts := []expect.ExpectOpt{expect.RegexpSubmatch(re, &m)}
 	if len(timeout) > 0 {
 		opts = append(opts, expect.WithTimeout(timeout[0]))
 	}
 
-	return cp.console.Expect(opts...)
+	if _, err := cp.expect(cp.ctx, opts...); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ExpectReDecode is like ExpectRe, but it also stores the text of the named capture groups in the
+// fields of the struct that v points to (see expect.RegexpMatch.Decode)
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectReDecode(value string, v interface{}, timeout ...time.Duration) (string, error) {
+	m, err := cp.ExpectReSubmatch(value, timeout...)
+	if err != nil {
+		return cp.rawString(), err
+	}
+	return cp.rawString(), m.Decode(v)
 }
 
 // ExpectLongString listens to the terminal output and returns once the expected value is found or
@@ -200,41 +471,101 @@ func (cp *ConsoleProcess) ExpectRe(value string, timeout ...time.Duration) (stri
 // for wrappings at the maximum terminal width.
 // Default timeout is 10 seconds
 func (cp *ConsoleProcess) ExpectLongString(value string, timeout ...time.Duration) (string, error) {
-	opts := []expect.ExpectOpt{expect.LongString(value)}
-	if len(timeout) > 0 {
-		opts = append(opts, expect.WithTimeout(timeout[0]))
-	}
+	return cp.ExpectLongStringContext(cp.ctx, value, timeout...)
+}
 
-	return cp.console.Expect(opts...)
+// ExpectLongStringContext is like ExpectLongString, but it also returns the context's error as soon
+// as ctx is done
+func (cp *ConsoleProcess) ExpectLongStringContext(ctx context.Context, value string, timeout ...time.Duration) (string, error) {
+	return cp.expectContext(ctx, expect.LongString(value), timeout...)
 }
 
 // Expect listens to the terminal output and returns once the expected value is found or
 // a timeout occurs
 // Default timeout is 10 seconds
 func (cp *ConsoleProcess) Expect(value string, timeout ...time.Duration) (string, error) {
-	opts := []expect.ExpectOpt{expect.String(value)}
-	if len(timeout) > 0 {
-		opts = append(opts, expect.WithTimeout(timeout[0]))
-	}
+	return cp.ExpectContext(cp.ctx, value, timeout...)
+}
 
-	return cp.console.Expect(opts...)
+// ExpectContext is like Expect, but it also returns the context's error as soon as ctx is done
+func (cp *ConsoleProcess) ExpectContext(ctx context.Context, value string, timeout ...time.Duration) (string, error) {
+	return cp.expectContext(ctx, expect.String(value), timeout...)
+}
+
+// ExpectNot listens to the terminal output for the given window of time and fails if the
+// value is found
+func (cp *ConsoleProcess) ExpectNot(value string, window time.Duration) (string, error) {
+	return cp.expect(cp.ctx, expect.Never(expect.String(value), window))
 }
 
 // ExpectCustom listens to the terminal output and returns once the supplied condition is satisfied or
 // a timeout occurs
 // Default timeout is 10 seconds
 func (cp *ConsoleProcess) ExpectCustom(opt expect.ExpectOpt, timeout ...time.Duration) (string, error) {
-	opts := []expect.ExpectOpt{opt}
+	return cp.ExpectCustomContext(cp.ctx, opt, timeout...)
+}
+
+// ExpectCustomContext is like ExpectCustom, but it also returns the context's error as soon as ctx
+// is done
+func (cp *ConsoleProcess) ExpectCustomContext(ctx context.Context, opt expect.ExpectOpt, timeout ...time.Duration) (string, error) {
+	return cp.expectContext(ctx, opt, timeout...)
+}
+
+// ExpectInHistory listens to the terminal output and returns once the expected value is found
+// anywhere in the scrollback history or a timeout occurs.  Unlike Expect, it also finds output that
+// has already been matched, and the value may span several lines separated by "\n".
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectInHistory(value string, timeout ...time.Duration) (string, error) {
+	opts := []expect.ExpectOpt{expect.HistoryString(value)}
 	if len(timeout) > 0 {
 		opts = append(opts, expect.WithTimeout(timeout[0]))
 	}
 
-	return cp.console.Expect(opts...)
+	return cp.expect(cp.ctx, opts...)
+}
+
+// ExpectInOrder listens to the terminal output and returns once all values have been found in the
+// given order, each after the previous one, or a timeout occurs.  On failure, the error reports the
+// first value that has not been found.
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectInOrder(values []string, timeout ...time.Duration) (string, error) {
+	steps := make([]expect.ExpectOpt, len(values))
+	for i, value := range values {
+		steps[i] = expect.String(value)
+	}
+	opts := []expect.ExpectOpt{expect.Sequence(steps...)}
+	if len(timeout) > 0 {
+		opts = append(opts, expect.WithTimeout(timeout[0]))
+	}
+
+	return cp.expect(cp.ctx, opts...)
+}
+
+// History returns the lines of the scrollback history and the screen of the terminal, with the
+// automatic line wraps removed
+func (cp *ConsoleProcess) History() []string {
+	return cp.console.History()
+}
+
+// SearchHistory returns the lines of the scrollback history and the screen that match the regular
+// expression pattern
+func (cp *ConsoleProcess) SearchHistory(pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return cp.console.SearchHistory(re), nil
 }
 
 // WaitForInput returns once a shell prompt is active on the terminal
+// With Options.ShellIntegration it waits for the prompt marker (see WaitForPrompt), otherwise it
+// sends an echo command and waits for its output.
 // Default timeout is 10 seconds
 func (cp *ConsoleProcess) WaitForInput(timeout ...time.Duration) (string, error) {
+	if cp.shell != nil {
+		return cp.WaitForPrompt(timeout...)
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		panic(err)
@@ -249,11 +580,32 @@ func (cp *ConsoleProcess) WaitForInput(timeout ...time.Duration) (string, error)
 	return cp.Expect("wait_ready_"+homeDir, timeout...)
 }
 
+// WaitForIdle returns once no output has been received for the quiet period and the terminal screen
+// has not changed during that time, e.g., after a TUI has finished redrawing the screen
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) WaitForIdle(quiet time.Duration, timeout ...time.Duration) (string, error) {
+	opts := []expect.ExpectOpt{expect.WaitForStableScreen(quiet)}
+	if len(timeout) > 0 {
+		opts = append(opts, expect.WithTimeout(timeout[0]))
+	}
+
+	return cp.expect(cp.ctx, opts...)
+}
+
 // Send sends a new line to the terminal, as if a user typed it
 func (cp *ConsoleProcess) Send(value string) {
 	_, _ = cp.console.SendLine(value)
 }
 
+// SendContext is like Send, but it returns the context's error if ctx is done before the line could be sent
+func (cp *ConsoleProcess) SendContext(ctx context.Context, value string) error {
+	ctx, cancel := cp.mergeContext(ctx)
+	defer cancel()
+
+	_, err := cp.console.SendContext(ctx, value+"\n")
+	return err
+}
+
 // SendLine sends a new line to the terminal, as if a user typed it, the newline sequence is OS aware
 func (cp *ConsoleProcess) SendLine(value string) {
 	_, _ = cp.console.SendOSLine(value)
@@ -264,6 +616,54 @@ func (cp *ConsoleProcess) SendUnterminated(value string) {
 	_, _ = cp.console.Send(value)
 }
 
+// SendKeys sends key presses to the terminal, as if a user typed them
+// The byte sequence of each key depends on the cursor and keypad modes that the application
+// has enabled on its terminal at the time the key is sent.  Note, that the terminal modes are
+// only updated while output is processed, so you usually want to Expect a prompt first.
+func (cp *ConsoleProcess) SendKeys(ks ...keys.Key) {
+	for _, k := range ks {
+		_, _ = cp.console.Send(k.Sequence(cp.keyMode()))
+	}
+}
+
+// keyMode returns the terminal modes that are relevant for encoding key presses
+func (cp *ConsoleProcess) keyMode() keys.Mode {
+	st := cp.console.Pty.State
+	st.Lock()
+	defer st.Unlock()
+	return keys.Mode{
+		AppCursor: st.Mode(vt10x.ModeAppCursor),
+		AppKeypad: st.Mode(vt10x.ModeAppKeypad),
+	}
+}
+
+// Resize changes the size of the pseudo-terminal and of the virtual terminal
+// On Linux and MacOS the process receives a SIGWINCH signal, even if the size has not changed.
+// The resize is recorded in the session recording and in the input log of the failure artifacts.
+func (cp *ConsoleProcess) Resize(cols, rows uint16) error {
+	if err := cp.console.Resize(cols, rows); err != nil {
+		return err
+	}
+	cp.report.resize(cols, rows)
+	if cp.cast != nil {
+		cp.cast.resize(int(cols), int(rows))
+	}
+	return nil
+}
+
+// ExpectRedraw returns once the process has printed output after the last call to Resize and the
+// terminal screen has not changed for the quiet period, e.g., after a TUI has redrawn the screen for
+// the new size
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectRedraw(quiet time.Duration, timeout ...time.Duration) (string, error) {
+	opts := []expect.ExpectOpt{expect.WaitForRedraw(quiet)}
+	if len(timeout) > 0 {
+		opts = append(opts, expect.WithTimeout(timeout[0]))
+	}
+
+	return cp.expect(cp.ctx, opts...)
+}
+
 // Signal sends an arbitrary signal to the running process
 func (cp *ConsoleProcess) Signal(sig os.Signal) error {
 	return cp.cmd.Process.Signal(sig)
@@ -285,6 +685,19 @@ func (cp *ConsoleProcess) Stop() error {
 	return cp.cmd.Process.Signal(os.Interrupt)
 }
 
+// mergeContext returns a context that is done when either ctx or the context of the ConsoleProcess is done
+func (cp *ConsoleProcess) mergeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	merged, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-cp.ctx.Done():
+			cancel()
+		case <-merged.Done():
+		}
+	}()
+	return merged, cancel
+}
+
 // MatchState returns the current state of the expect-matcher
 func (cp *ConsoleProcess) MatchState() *expect.MatchState {
 	return cp.console.MatchState
@@ -297,6 +710,50 @@ func (cp *ConsoleProcess) rawString() string {
 	return cp.console.MatchState.Buf.String()
 }
 
+// expect waits for the conditions in opts, and adds the exit state of the process to a
+// expect.ProcessGoneError
+func (cp *ConsoleProcess) expect(ctx context.Context, opts ...expect.ExpectOpt) (string, error) {
+	out, err := cp.console.ExpectContext(ctx, opts...)
+	var gone *expect.ProcessGoneError
+	if errors.As(err, &gone) && cp.cmd != nil {
+		select {
+		case <-cp.exited:
+			gone.ProcessState = cp.cmd.ProcessState
+		default:
+		}
+	}
+	return out, err
+}
+
+// expectContext listens to the terminal output until the condition opt is met, the timeout has
+// passed, or ctx or the context of the ConsoleProcess is done
+func (cp *ConsoleProcess) expectContext(ctx context.Context, opt expect.ExpectOpt, timeout ...time.Duration) (string, error) {
+	ctx, cancel := cp.mergeContext(ctx)
+	defer cancel()
+
+	opts := []expect.ExpectOpt{opt}
+	if len(timeout) > 0 {
+		opts = append(opts, expect.WithTimeout(timeout[0]))
+	}
+
+	return cp.expect(ctx, opts...)
+}
+
+// waitError converts the error err returned by wait while waiting for the conditions of the
+// matchers since start into an expect.ExpectTimeoutError if the wait has timed out
+func (cp *ConsoleProcess) waitError(matchers []expect.Matcher, start time.Time, err error) error {
+	if !errors.Is(err, ErrWaitTimeout) {
+		return fmt.Errorf("process failed with error: %w", err)
+	}
+	return &expect.ExpectTimeoutError{
+		Criteria: expect.CriteriaStrings(matchers),
+		Elapsed:  time.Since(start),
+		Screen:   cp.Snapshot(),
+		Buffer:   cp.rawString(),
+		Err:      err,
+	}
+}
+
 type exitCodeMatcher struct {
 	exitCode int
 	expected bool
@@ -315,22 +772,43 @@ func (em *exitCodeMatcher) Criteria() interface{} {
 	return fmt.Sprintf("exit code %s %d", comparator, em.exitCode)
 }
 
+// observeExpect reports an expectation that could not be met to the observers
+func (cp *ConsoleProcess) observeExpect(matchers []expect.Matcher, err error) {
+	cp.report.observeExpect(matchers, cp.MatchState(), err)
+	cp.opts.ObserveExpect(matchers, cp.MatchState(), err)
+}
+
 // ExpectExitCode waits for the program under test to terminate, and checks that the returned exit code meets expectations
 func (cp *ConsoleProcess) ExpectExitCode(exitCode int, timeout ...time.Duration) (string, error) {
-	_, err := cp.wait(timeout...)
+	return cp.ExpectExitCodeContext(cp.ctx, exitCode, timeout...)
+}
+
+// ExpectExitCodeContext is like ExpectExitCode, but it stops waiting and returns the context's error
+// as soon as ctx is done
+func (cp *ConsoleProcess) ExpectExitCodeContext(ctx context.Context, exitCode int, timeout ...time.Duration) (string, error) {
+	ctx, cancel := cp.mergeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cp.wait(ctx, timeout...)
 	if err == nil && exitCode == 0 {
 		return cp.rawString(), nil
 	}
 	matchers := []expect.Matcher{&exitCodeMatcher{exitCode, true}}
-	eexit, ok := err.(*exec.ExitError)
-	if !ok {
-		e := fmt.Errorf("process failed with error: %w", err)
-		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		e := cp.waitError(matchers, start, err)
+		cp.observeExpect(matchers, e)
+		return cp.rawString(), e
+	}
+	status := newExitStatus(cp.cmd.ProcessState, cp.started, cp.ended)
+	if status.Signal != nil {
+		e := cp.exitCodeMismatch(matchers, status, start, fmt.Sprintf("exit code wrong: process was %v (expected %d)", status, exitCode))
+		cp.observeExpect(matchers, e)
 		return cp.rawString(), e
 	}
-	if eexit.ExitCode() != exitCode {
-		e := fmt.Errorf("exit code wrong: was %d (expected %d)", eexit.ExitCode(), exitCode)
-		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+	if status.ExitCode != exitCode {
+		e := cp.exitCodeMismatch(matchers, status, start, fmt.Sprintf("exit code wrong: was %d (expected %d)", status.ExitCode, exitCode))
+		cp.observeExpect(matchers, e)
 		return cp.rawString(), e
 	}
 	return cp.rawString(), nil
@@ -338,25 +816,27 @@ func (cp *ConsoleProcess) ExpectExitCode(exitCode int, timeout ...time.Duration)
 
 // ExpectNotExitCode waits for the program under test to terminate, and checks that the returned exit code is not the value provide
 func (cp *ConsoleProcess) ExpectNotExitCode(exitCode int, timeout ...time.Duration) (string, error) {
-	_, err := cp.wait(timeout...)
+	return cp.ExpectNotExitCodeContext(cp.ctx, exitCode, timeout...)
+}
+
+// ExpectNotExitCodeContext is like ExpectNotExitCode, but it stops waiting and returns the context's
+// error as soon as ctx is done
+func (cp *ConsoleProcess) ExpectNotExitCodeContext(ctx context.Context, exitCode int, timeout ...time.Duration) (string, error) {
+	ctx, cancel := cp.mergeContext(ctx)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cp.wait(ctx, timeout...)
 	matchers := []expect.Matcher{&exitCodeMatcher{exitCode, false}}
-	if err == nil {
-		if exitCode == 0 {
-			e := fmt.Errorf("exit code wrong: should not have been 0")
-			cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
-			return cp.rawString(), e
-		}
-		return cp.rawString(), nil
-	}
-	eexit, ok := err.(*exec.ExitError)
-	if !ok {
-		e := fmt.Errorf("process failed with error: %w", err)
-		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		e := cp.waitError(matchers, start, err)
+		cp.observeExpect(matchers, e)
 		return cp.rawString(), e
 	}
-	if eexit.ExitCode() == exitCode {
-		e := fmt.Errorf("exit code wrong: should not have been %d", exitCode)
-		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+	status := newExitStatus(cp.cmd.ProcessState, cp.started, cp.ended)
+	if status.ExitCode == exitCode {
+		e := cp.exitCodeMismatch(matchers, status, start, fmt.Sprintf("exit code wrong: should not have been %d", exitCode))
+		cp.observeExpect(matchers, e)
 		return cp.rawString(), e
 	}
 	return cp.rawString(), nil
@@ -364,17 +844,24 @@ func (cp *ConsoleProcess) ExpectNotExitCode(exitCode int, timeout ...time.Durati
 
 // Wait waits for the program under test to terminate, not caring about the exit code at all
 func (cp *ConsoleProcess) Wait(timeout ...time.Duration) {
-	_, err := cp.wait(timeout...)
+	cp.WaitContext(cp.ctx, timeout...)
+}
+
+// WaitContext is like Wait, but it stops waiting as soon as ctx is done
+func (cp *ConsoleProcess) WaitContext(ctx context.Context, timeout ...time.Duration) {
+	ctx, cancel := cp.mergeContext(ctx)
+	defer cancel()
+
+	_, err := cp.wait(ctx, timeout...)
 	if err != nil {
-		fmt.Printf("Process exited with error: %v (This is not fatal when using Wait())", err)
+		fmt.Fprintf(cp.opts.LogWriter, "Process exited with error: %v (This is not fatal when using Wait())", err)
 	}
 }
 
-// forceKill kills the underlying process and waits until it return the exit error
+// forceKill terminates the underlying process and the processes it has started, and waits until it
+// returns the exit error
 func (cp *ConsoleProcess) forceKill() {
-	if err := cp.cmd.Process.Kill(); err != nil {
-		panic(err)
-	}
+	cp.terminate()
 	<-cp.errs
 }
 
@@ -383,7 +870,8 @@ func (cp *ConsoleProcess) forceKill() {
 // Note, that without draining the output pipe, the process might hang.
 // As soon as the process actually finishes, it waits for the underlying console to be closed
 // and gives all readers a chance to read remaining bytes.
-func (cp *ConsoleProcess) wait(timeout ...time.Duration) (*os.ProcessState, error) {
+// It stops waiting when ctx is done, which has to be done when the context of the ConsoleProcess is.
+func (cp *ConsoleProcess) wait(ctx context.Context, timeout ...time.Duration) (*os.ProcessState, error) {
 	if cp.cmd == nil || cp.cmd.Process == nil {
 		panic(ErrNoProcess.Error())
 	}
@@ -396,7 +884,8 @@ func (cp *ConsoleProcess) wait(timeout ...time.Duration) (*os.ProcessState, erro
 	finalErrCh := make(chan error)
 	defer close(finalErrCh)
 	go func() {
-		_, err := cp.console.Expect(
+		_, err := cp.console.ExpectContext(
+			ctx,
 			expect.Any(expect.PTSClosed, expect.StdinClosed, expect.EOF),
 			expect.WithTimeout(t),
 		)
@@ -413,7 +902,7 @@ func (cp *ConsoleProcess) wait(timeout ...time.Duration) (*os.ProcessState, erro
 			log.Printf("Failed to close the console readers: %v", err)
 		}
 		// we only expect timeout or EOF errors here, otherwise something went wrong
-		if expErr != nil && !(os.IsTimeout(expErr) || expErr == io.EOF) {
+		if expErr != nil && !(os.IsTimeout(expErr) || errors.Is(expErr, io.EOF)) {
 			return nil, fmt.Errorf("unexpected error while waiting for exit code: %v", expErr)
 		}
 		return cp.cmd.ProcessState, perr
@@ -423,9 +912,9 @@ func (cp *ConsoleProcess) wait(timeout ...time.Duration) (*os.ProcessState, erro
 		log.Println("killing process after timeout")
 		cp.forceKill()
 		return nil, ErrWaitTimeout
-	case <-cp.ctx.Done():
+	case <-ctx.Done():
 		// wait until expect returns (will be forced by closed console)
 		<-finalErrCh
-		return nil, fmt.Errorf("ConsoleProcess context canceled")
+		return nil, fmt.Errorf("ConsoleProcess context canceled: %w", ctx.Err())
 	}
 }
@@ -5,6 +5,8 @@
 package termtest_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -12,12 +14,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	expect "github.com/ActiveState/termtest/expect"
 	"github.com/ActiveState/termtest"
+	"github.com/ActiveState/termtest/keys"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -114,6 +118,22 @@ func (suite *TermTestTestSuite) TestTermTest() {
 	}
 }
 
+func (suite *TermTestTestSuite) TestLogWriter() {
+	var log bytes.Buffer
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:   termtest.TestSendObserveFn(suite.T()),
+		ObserveExpect: termtest.TestExpectObserveFn(suite.T()),
+		CmdName:       suite.sessionTester,
+		LogWriter:     &log,
+	})
+	suite.Require().NoError(err)
+	defer cp.Close()
+
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(err)
+	suite.Contains(log.String(), "Spawning '"+suite.sessionTester+"'")
+}
+
 func (suite *TermTestTestSuite) TestExitCode() {
 	cases := []struct {
 		Name     string
@@ -195,9 +215,50 @@ func (suite *TermTestTestSuite) TestTimeout() {
 	_, err := cp.ExpectExitCode(0, 100*time.Millisecond)
 	suite.Error(err)
 	suite.True(errors.Is(err, termtest.ErrWaitTimeout), "expected timeout error, got %v", err)
+	suite.True(os.IsTimeout(err), "expected timeout error, got %v", err)
+	var timeoutErr *expect.ExpectTimeoutError
+	suite.Require().True(errors.As(err, &timeoutErr), "expected an ExpectTimeoutError, got %T", err)
+	suite.Equal([]string{"exit code == 0"}, timeoutErr.Criteria)
 	suite.True(errorFound, "expect to observe an error")
 }
 
+func (suite *TermTestTestSuite) TestTypedErrors() {
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-exit1")
+	defer cp.Close()
+
+	_, err := cp.Expect("an unexpected string", 100*time.Millisecond)
+	suite.True(os.IsTimeout(err), "expected timeout error, got %v", err)
+	var timeoutErr *expect.ExpectTimeoutError
+	suite.Require().True(errors.As(err, &timeoutErr), "expected an ExpectTimeoutError, got %T", err)
+	suite.Equal([]string{"an unexpected string"}, timeoutErr.Criteria)
+	suite.Contains(timeoutErr.Screen, "an expected string")
+	suite.Contains(timeoutErr.Buffer, "an expected string")
+	suite.Require().Len(timeoutErr.Closest, 1)
+	suite.Equal("an expected string", timeoutErr.Closest[0].Text)
+	suite.Contains(err.Error(), `closest match for "an unexpected string"`)
+
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	var mismatch *termtest.ExitCodeMismatchError
+	suite.Require().True(errors.As(err, &mismatch), "expected an ExitCodeMismatchError, got %T", err)
+	suite.Equal("exit code wrong: was 1 (expected 0)", err.Error())
+	suite.Equal([]string{"exit code == 0"}, mismatch.Criteria)
+	suite.Equal(1, mismatch.Status.ExitCode)
+	suite.Contains(mismatch.Screen, "an expected string")
+
+	_, err = cp.ExpectNotExitCode(1)
+	suite.Require().True(errors.As(err, &mismatch), "expected an ExitCodeMismatchError, got %T", err)
+	suite.Equal([]string{"exit code != 1"}, mismatch.Criteria)
+
+	// the terminal has been closed after the process has exited
+	_, err = cp.Expect("an unexpected string", 10*time.Second)
+	suite.False(os.IsTimeout(err), "expected the output to end, got %v", err)
+	var gone *expect.ProcessGoneError
+	suite.Require().True(errors.As(err, &gone), "expected a ProcessGoneError, got %T", err)
+	suite.Equal([]string{"an unexpected string"}, gone.Criteria)
+	suite.Require().NotNil(gone.ProcessState)
+	suite.Equal(1, gone.ProcessState.ExitCode())
+}
+
 func (suite *TermTestTestSuite) TestInterrupt() {
 	// create a new test-session
 	cp := suite.spawn(false, "-sleep", "-exit1")
@@ -208,6 +269,315 @@ func (suite *TermTestTestSuite) TestInterrupt() {
 	cp.ExpectExitCode(123, 10*time.Second)
 }
 
+func (suite *TermTestTestSuite) TestExpectNot() {
+	cp := suite.spawn(false, "-stutter")
+	defer cp.Close()
+
+	_, err := cp.ExpectNot("panic", 300*time.Millisecond)
+	suite.NoError(err)
+	_, _ = cp.Expect("stuttered 20 times", 10*time.Second)
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestExpectNotFails() {
+	var observed error
+	cp := suite.spawnCustom(false, func(matchers []expect.Matcher, ms *expect.MatchState, err error) {
+		if err != nil {
+			observed = err
+		}
+	}, "-stutter")
+	defer cp.Close()
+
+	_, err := cp.ExpectNot("stuttered 3 times", 5*time.Second)
+	suite.True(errors.Is(err, expect.ErrUnwantedMatch), "expected unwanted match error, got %v", err)
+	suite.Equal(err, observed)
+}
+
+func (suite *TermTestTestSuite) TestExpectInOrder() {
+	cp := suite.spawn(false, "-stutter")
+	defer cp.Close()
+
+	_, err := cp.ExpectInOrder([]string{"stuttered 1 times", "stuttered 5 times", "stuttered 10 times"}, 10*time.Second)
+	suite.Require().NoError(err)
+	cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestExpectInOrderFails() {
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-stutter")
+	defer cp.Close()
+
+	_, err := cp.ExpectInOrder([]string{"stuttered 3 times", "stuttered 2 times", "stuttered 4 times"}, time.Second)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "reached step 2 of 3: stuttered 2 times")
+	cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestSendKeys() {
+	cp := suite.spawn(false, "-read-keys")
+	defer cp.Close()
+
+	_, _ = cp.Expect("waiting for keys", 10*time.Second)
+	cp.SendKeys(keys.Up, keys.F5, keys.Alt('b'), keys.Text("x"), keys.Enter)
+	_, _ = cp.Expect(`received keys: "\x1bOA\x1b[15~\x1bbx\n"`, 10*time.Second)
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestHistory() {
+	cp := suite.spawn(false, "-stutter")
+	defer cp.Close()
+
+	_, _ = cp.Expect("stuttered 20 times", 10*time.Second)
+	_, err := cp.ExpectInHistory("stuttered 1 times\nstuttered 2 times", time.Second)
+	suite.NoError(err)
+	found, err := cp.SearchHistory(`^stuttered 1\d times$`)
+	suite.NoError(err)
+	suite.Len(found, 10)
+	suite.Contains(cp.History(), "an expected string")
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestHistoryLimit() {
+	cp, err := termtest.New(termtest.Options{
+		CmdName:         suite.sessionTester,
+		Args:            []string{"-fill-buffer"},
+		MaxHistoryLines: 10,
+	})
+	suite.Require().NoError(err)
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	// the output is a single line, wrapped on 300 rows, and only the last 10 rows
+	// of the history and the 30 rows of the screen are kept
+	history := cp.History()
+	suite.Require().NotEmpty(history)
+	suite.LessOrEqual(len(strings.Join(history, "")), 40*80)
+	suite.True(strings.HasSuffix(history[0], ":299:"+strings.Repeat("5678901234", 7)+"56789"), "history ends with the last line of output")
+}
+
+func (suite *TermTestTestSuite) TestResize() {
+	if runtime.GOOS == "windows" {
+		suite.T().Skip("Windows does not signal changes of the terminal size")
+	}
+	cp := suite.spawn(false, "-winch")
+	defer cp.Close()
+
+	_, _ = cp.Expect("waiting for resize", 10*time.Second)
+	// the process is signaled even if the size does not change
+	suite.Require().NoError(cp.Resize(80, 30))
+	_, err := cp.Expect("resized to 80x30", 10*time.Second)
+	suite.NoError(err)
+
+	suite.Require().NoError(cp.Resize(100, 40))
+	_, err = cp.ExpectRedraw(50*time.Millisecond, 10*time.Second)
+	suite.NoError(err)
+	suite.Contains(cp.Snapshot(), "resized to 100x40")
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
+
 func TestTermTestTestSuite(t *testing.T) {
 	suite.Run(t, new(TermTestTestSuite))
 }
+
+func (suite *TermTestTestSuite) TestNewWithContext() {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	cp, err := termtest.NewWithContext(ctx, termtest.Options{
+		ObserveSend:   termtest.TestSendObserveFn(suite.Suite.T()),
+		ObserveExpect: func([]expect.Matcher, *expect.MatchState, error) {},
+		CmdName:       suite.sessionTester,
+		Args:          []string{"-sleep"},
+	})
+	suite.Require().NoError(err, "create console process")
+	defer cp.Close()
+
+	start := time.Now()
+	_, err = cp.Expect("never printed", 10*time.Second)
+	suite.True(errors.Is(err, context.DeadlineExceeded), "expected deadline exceeded error, got %v", err)
+	suite.Less(int64(time.Since(start)), int64(5*time.Second), "expectation aborted early")
+
+	select {
+	case <-cp.Exited():
+		suite.NotNil(cp.Cmd().ProcessState)
+	case <-time.After(5 * time.Second):
+		suite.Fail("process is not killed")
+	}
+}
+
+func (suite *TermTestTestSuite) TestExpectContext() {
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:   func(string, int, error) {},
+		ObserveExpect: func([]expect.Matcher, *expect.MatchState, error) {},
+		CmdName:       suite.sessionTester,
+		Args:          []string{"-sleep"},
+	})
+	suite.Require().NoError(err, "create console process")
+	defer cp.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err = cp.ExpectContext(ctx, "never printed", 10*time.Second)
+	suite.True(errors.Is(err, context.Canceled), "expected canceled error, got %v", err)
+
+	err = cp.SendContext(ctx, "ignored")
+	suite.True(errors.Is(err, context.Canceled), "expected canceled error, got %v", err)
+}
+
+func (suite *TermTestTestSuite) TestExpectExitCodeContext() {
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:   func(string, int, error) {},
+		ObserveExpect: func([]expect.Matcher, *expect.MatchState, error) {},
+		CmdName:       suite.sessionTester,
+		Args:          []string{"-sleep"},
+	})
+	suite.Require().NoError(err, "create console process")
+	defer cp.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err = cp.ExpectReContext(ctx, "never printed", 10*time.Second)
+	suite.True(errors.Is(err, context.Canceled), "expected canceled error, got %v", err)
+
+	start := time.Now()
+	_, err = cp.ExpectExitCodeContext(ctx, 0, 10*time.Second)
+	suite.True(errors.Is(err, context.Canceled), "expected canceled error, got %v", err)
+	suite.Less(int64(time.Since(start)), int64(5*time.Second), "waited for the process to exit")
+}
+
+func (suite *TermTestTestSuite) TestWaitForIdle() {
+	cp := suite.spawn(false, "-stutter")
+	defer cp.Close()
+
+	_, err := cp.WaitForIdle(200*time.Millisecond, 5*time.Second)
+	suite.Require().NoError(err)
+	suite.Contains(cp.Snapshot(), "stuttered 20 times")
+	cp.ExpectExitCode(0)
+}
+
+func (suite *TermTestTestSuite) TestNewTestCleanup() {
+	var cp *termtest.ConsoleProcess
+	suite.T().Run("spawn", func(t *testing.T) {
+		var err error
+		cp, err = termtest.NewTest(t, termtest.Options{
+			CmdName: suite.sessionTester,
+			Args:    []string{"-sleep"},
+		})
+		suite.Require().NoError(err, "create console process")
+	})
+
+	select {
+	case <-cp.Exited():
+		suite.NotNil(cp.Cmd().ProcessState)
+	case <-time.After(5 * time.Second):
+		suite.Fail("process is not killed")
+	}
+	_, err := os.Stat(cp.WorkDirectory())
+	suite.True(os.IsNotExist(err), "work directory is removed, got %v", err)
+}
+
+// cleanupTB is a testing.TB that runs the cleanup functions on demand and records errors and logs
+type cleanupTB struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+	logs     []string
+}
+
+func (t *cleanupTB) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *cleanupTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *cleanupTB) Logf(format string, args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
+
+func (t *cleanupTB) Failed() bool {
+	return len(t.errors) > 0
+}
+
+func (t *cleanupTB) runCleanups() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func (suite *TermTestTestSuite) TestNewTestCleanupExitCodeChecked() {
+	for i := 0; i < 5; i++ {
+		tb := &cleanupTB{TB: suite.T()}
+		cp, err := termtest.NewTest(tb, termtest.Options{
+			CmdName:  suite.sessionTester,
+			CastFile: filepath.Join(suite.tmpDir, "checked.cast"),
+		})
+		suite.Require().NoError(err)
+
+		_, err = cp.ExpectExitCode(0, 10*time.Second)
+		suite.Require().NoError(err)
+		tb.runCleanups()
+		suite.Empty(tb.logs, "the exit code has been checked")
+	}
+}
+
+func (suite *TermTestTestSuite) TestLeftoverProcesses() {
+	if runtime.GOOS == "windows" {
+		suite.T().Skip("the processes of a session cannot be listed on Windows")
+	}
+	tb := &cleanupTB{TB: suite.T()}
+	cp, err := termtest.NewTest(tb, termtest.Options{
+		CmdName:              suite.sessionTester,
+		Args:                 []string{"-spawn-child"},
+		KillGracePeriod:      100 * time.Millisecond,
+		CheckLeakedProcesses: true,
+		ArtifactsDir:         filepath.Join(suite.tmpDir, "leftover-artifacts"),
+		CastFile:             filepath.Join(suite.tmpDir, "leftover.cast"),
+	})
+	suite.Require().NoError(err)
+
+	_, err = cp.Expect("started child", 10*time.Second)
+	suite.Require().NoError(err)
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(err)
+
+	leftover, err := cp.LeftoverProcesses()
+	suite.Require().NoError(err)
+	suite.Require().Len(leftover, 1)
+	suite.Contains(leftover[0], "-ignore-term -sleep")
+
+	// the child ignores SIGTERM, and is killed after the grace period
+	start := time.Now()
+	tb.runCleanups()
+	suite.GreaterOrEqual(int64(time.Since(start)), int64(100*time.Millisecond))
+	suite.Require().Len(tb.errors, 1)
+	suite.Contains(tb.errors[0], "-ignore-term -sleep")
+
+	suite.Eventually(func() bool {
+		leftover, err := cp.LeftoverProcesses()
+		return err == nil && len(leftover) == 0
+	}, 5*time.Second, 50*time.Millisecond, "child is killed")
+}
+
+func (suite *TermTestTestSuite) TestExpectReDecode() {
+	cp := suite.spawn(false, "-stutter")
+	defer cp.Close()
+
+	m, err := cp.ExpectReSubmatch(`stuttered (\d+) times\s`, 5*time.Second)
+	suite.Require().NoError(err)
+	suite.Equal("1", m.Groups[1])
+
+	var res struct {
+		Count int `expect:"count"`
+	}
+	_, err = cp.ExpectReDecode(`stuttered (?P<count>\d+) times\s`, &res, 5*time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(2, res.Count)
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
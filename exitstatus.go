@@ -0,0 +1,234 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+)
+
+// ExitStatus describes how the process under test has terminated and the resources it has used
+type ExitStatus struct {
+	// ExitCode is the exit code of the process, or -1 if it has been terminated by a signal
+	ExitCode int
+	// Signal is the signal that terminated the process, it is nil if the process exited normally
+	// Signals are not reported on Windows.
+	Signal os.Signal
+	// CoreDumped is true if the process has dumped its core when it was terminated by the signal
+	CoreDumped bool
+	// WallTime is the time between the start and the exit of the process
+	WallTime time.Duration
+	// UserTime and SystemTime are the CPU time that the process has spent in user and system mode
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the maximum resident set size of the process in bytes, it is zero if it is unknown
+	MaxRSS int64
+}
+
+// String describes how the process has terminated
+func (s *ExitStatus) String() string {
+	if s.Signal == nil {
+		return fmt.Sprintf("exit code %d", s.ExitCode)
+	}
+	if s.CoreDumped {
+		return fmt.Sprintf("terminated by signal %v (core dumped)", s.Signal)
+	}
+	return fmt.Sprintf("terminated by signal %v", s.Signal)
+}
+
+// ExitCodeMismatchError is returned if the exit status of the process does not meet the expectations
+// of ExpectExitCode, ExpectNotExitCode, ExpectExitStatus or ExpectExitSignal
+type ExitCodeMismatchError struct {
+	// Criteria are the criteria of the conditions that have not been met, e.g., "exit code == 0"
+	Criteria []string
+	// Status is the exit status of the process
+	Status *ExitStatus
+	// Elapsed is the time waited for the process to exit
+	Elapsed time.Duration
+	// Screen is the visible screen of the terminal
+	Screen string
+	// Buffer is the raw terminal output since the last match
+	Buffer string
+
+	msg string
+}
+
+func (e *ExitCodeMismatchError) Error() string {
+	return e.msg
+}
+
+// exitCodeMismatch returns an ExitCodeMismatchError for the matchers that the exit status does not meet
+func (cp *ConsoleProcess) exitCodeMismatch(matchers []expect.Matcher, status *ExitStatus, start time.Time, msg string) error {
+	return &ExitCodeMismatchError{
+		Criteria: expect.CriteriaStrings(matchers),
+		Status:   status,
+		Elapsed:  time.Since(start),
+		Screen:   cp.Snapshot(),
+		Buffer:   cp.rawString(),
+		msg:      msg,
+	}
+}
+
+// resources describes the resources that the process has used
+func (s *ExitStatus) resources() string {
+	res := fmt.Sprintf("wall time %v, user time %v, system time %v", s.WallTime, s.UserTime, s.SystemTime)
+	if s.MaxRSS > 0 {
+		res += fmt.Sprintf(", max RSS %d KiB", s.MaxRSS/1024)
+	}
+	return res
+}
+
+// newExitStatus returns the exit status of a process that has been started at start and exited at end
+func newExitStatus(ps *os.ProcessState, start, end time.Time) *ExitStatus {
+	s := &ExitStatus{
+		ExitCode:   ps.ExitCode(),
+		WallTime:   end.Sub(start),
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+		MaxRSS:     maxRSS(ps),
+	}
+	s.Signal, s.CoreDumped = terminatingSignal(ps)
+	return s
+}
+
+// ExitCondition is a condition on the exit status of the process, see ExpectExitStatus
+// It fulfills the expect.Matcher interface, such that it is reported like other expectations.
+type ExitCondition struct {
+	criteria string
+	match    func(*ExitStatus) bool
+}
+
+// Match returns true if v is an *ExitStatus that meets the condition
+func (c ExitCondition) Match(v interface{}) bool {
+	s, ok := v.(*ExitStatus)
+	return ok && c.match(s)
+}
+
+// Criteria describes the condition
+func (c ExitCondition) Criteria() interface{} {
+	return c.criteria
+}
+
+// ExitCodeIs is met if the process has exited with the exit code
+func ExitCodeIs(exitCode int) ExitCondition {
+	return ExitCondition{
+		criteria: fmt.Sprintf("exit code == %d", exitCode),
+		match: func(s *ExitStatus) bool {
+			return s.Signal == nil && s.ExitCode == exitCode
+		},
+	}
+}
+
+// ExitSignalIs is met if the process has been terminated by the signal
+func ExitSignalIs(sig os.Signal) ExitCondition {
+	return ExitCondition{
+		criteria: fmt.Sprintf("terminated by signal %v", sig),
+		match: func(s *ExitStatus) bool {
+			return s.Signal != nil && s.Signal.String() == sig.String()
+		},
+	}
+}
+
+// CoreDumped is met if the process has dumped its core
+func CoreDumped() ExitCondition {
+	return ExitCondition{
+		criteria: "core dumped",
+		match: func(s *ExitStatus) bool {
+			return s.CoreDumped
+		},
+	}
+}
+
+// WallTimeBelow is met if the process has exited within the duration d after it has been started
+func WallTimeBelow(d time.Duration) ExitCondition {
+	return ExitCondition{
+		criteria: fmt.Sprintf("wall time < %v", d),
+		match: func(s *ExitStatus) bool {
+			return s.WallTime < d
+		},
+	}
+}
+
+// CPUTimeBelow is met if the process has spent less than d of user and system CPU time
+func CPUTimeBelow(d time.Duration) ExitCondition {
+	return ExitCondition{
+		criteria: fmt.Sprintf("CPU time < %v", d),
+		match: func(s *ExitStatus) bool {
+			return s.UserTime+s.SystemTime < d
+		},
+	}
+}
+
+// MaxRSSBelow is met if the maximum resident set size of the process has been less than the given
+// number of bytes.  It is not met if the maximum resident set size is unknown.
+func MaxRSSBelow(bytes int64) ExitCondition {
+	return ExitCondition{
+		criteria: fmt.Sprintf("max RSS < %d bytes", bytes),
+		match: func(s *ExitStatus) bool {
+			return s.MaxRSS > 0 && s.MaxRSS < bytes
+		},
+	}
+}
+
+// ExitStatus waits for the program under test to terminate and returns its exit status
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExitStatus(timeout ...time.Duration) (*ExitStatus, error) {
+	select {
+	case <-cp.waited:
+	default:
+		_, err := cp.wait(cp.ctx, timeout...)
+		var eexit *exec.ExitError
+		if err != nil && !errors.As(err, &eexit) {
+			return nil, err
+		}
+	}
+	return newExitStatus(cp.cmd.ProcessState, cp.started, cp.ended), nil
+}
+
+// ExpectExitStatus waits for the program under test to terminate, and checks that its exit status
+// meets all conditions
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectExitStatus(conds []ExitCondition, timeout ...time.Duration) (*ExitStatus, error) {
+	matchers := make([]expect.Matcher, len(conds))
+	for i, c := range conds {
+		matchers[i] = c
+	}
+	start := time.Now()
+	status, err := cp.ExitStatus(timeout...)
+	if err != nil {
+		e := cp.waitError(matchers, start, err)
+		cp.observeExpect(matchers, e)
+		return nil, e
+	}
+
+	var failed []expect.Matcher
+	for _, m := range matchers {
+		if !m.Match(status) {
+			failed = append(failed, m)
+		}
+	}
+	if len(failed) > 0 {
+		msg := fmt.Sprintf("exit status wrong: %v, %s (expected %s)", status, status.resources(), strings.Join(expect.CriteriaStrings(failed), ", "))
+		e := cp.exitCodeMismatch(failed, status, start, msg)
+		cp.observeExpect(failed, e)
+		return status, e
+	}
+	return status, nil
+}
+
+// ExpectExitSignal waits for the program under test to terminate, and checks that it has been
+// terminated by the signal sig
+// This is not supported on Windows.
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) ExpectExitSignal(sig os.Signal, timeout ...time.Duration) (string, error) {
+	_, err := cp.ExpectExitStatus([]ExitCondition{ExitSignalIs(sig)}, timeout...)
+	return cp.rawString(), err
+}
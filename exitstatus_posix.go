@@ -0,0 +1,35 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build linux darwin
+
+package termtest
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// terminatingSignal returns the signal that terminated the process and whether it has dumped its core
+func terminatingSignal(ps *os.ProcessState) (os.Signal, bool) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return nil, false
+	}
+	return ws.Signal(), ws.CoreDump()
+}
+
+// maxRSS returns the maximum resident set size of the process in bytes
+func maxRSS(ps *os.ProcessState) int64 {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// MacOS reports the size in bytes, Linux in kilobytes
+	if runtime.GOOS == "darwin" {
+		return int64(ru.Maxrss)
+	}
+	return int64(ru.Maxrss) * 1024
+}
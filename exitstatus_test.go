@@ -0,0 +1,68 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+	"github.com/ActiveState/termtest"
+)
+
+func (suite *TermTestTestSuite) TestExitStatus() {
+	// the observer of spawn fails the test on the expected mismatch
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-exit1")
+	defer cp.Close()
+
+	status, err := cp.ExpectExitStatus([]termtest.ExitCondition{
+		termtest.ExitCodeIs(1),
+		termtest.WallTimeBelow(10 * time.Second),
+		termtest.CPUTimeBelow(10 * time.Second),
+	}, 10*time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(1, status.ExitCode)
+	suite.Nil(status.Signal)
+	suite.False(status.CoreDumped)
+	suite.Greater(int64(status.WallTime), int64(0))
+	if runtime.GOOS != "windows" {
+		suite.Greater(status.MaxRSS, int64(0))
+	}
+	suite.Equal("exit code 1", status.String())
+
+	// the exit status can be checked again
+	_, err = cp.ExpectExitStatus([]termtest.ExitCondition{termtest.ExitCodeIs(0)})
+	suite.Error(err)
+	suite.Contains(err.Error(), "exit status wrong: exit code 1")
+	var mismatch *termtest.ExitCodeMismatchError
+	suite.Require().True(errors.As(err, &mismatch), "expected an ExitCodeMismatchError, got %T", err)
+	suite.Equal([]string{"exit code == 0"}, mismatch.Criteria)
+	suite.Equal(1, mismatch.Status.ExitCode)
+}
+
+func (suite *TermTestTestSuite) TestExpectExitSignal() {
+	if runtime.GOOS == "windows" {
+		suite.T().Skip("processes are not terminated by signals on Windows")
+	}
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-sleep")
+	defer cp.Close()
+
+	_, _ = cp.Expect("an expected string", 10*time.Second)
+	suite.Require().NoError(cp.Signal(syscall.SIGTERM))
+	_, err := cp.ExpectExitSignal(syscall.SIGTERM, 10*time.Second)
+	suite.Require().NoError(err)
+
+	status, err := cp.ExitStatus()
+	suite.Require().NoError(err)
+	suite.Equal(-1, status.ExitCode)
+	suite.Equal(syscall.SIGTERM, status.Signal)
+	suite.Equal("terminated by signal terminated", status.String())
+
+	_, err = cp.ExpectExitStatus([]termtest.ExitCondition{termtest.ExitCodeIs(0)})
+	suite.Error(err)
+	suite.Contains(err.Error(), "terminated by signal terminated")
+}
@@ -0,0 +1,21 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build windows
+
+package termtest
+
+import (
+	"os"
+)
+
+// terminatingSignal returns nil, as processes are not terminated by signals on Windows
+func terminatingSignal(ps *os.ProcessState) (os.Signal, bool) {
+	return nil, false
+}
+
+// maxRSS returns zero, as the maximum resident set size of a process is unknown on Windows
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ActiveState/vt10x"
+)
+
+// ClosestMatch describes the text on the screen of the terminal that comes
+// closest to a string or a regular expression that has not been found
+type ClosestMatch struct {
+	// Criteria is the expected string or the regular expression.  Spaces and
+	// newlines are removed from strings that are expected with LongString.
+	Criteria string
+	// Text is the text on the screen that comes closest to the criteria
+	Text string
+	// Row is the screen row on which Text starts
+	Row int
+	// Prefix is the number of runes at the start of the criteria that match,
+	// for a regular expression the length of the longest prefix of the pattern
+	// that matches Text
+	Prefix int
+	// Distance is the edit distance between Text and the expected string, or
+	// -1 for a regular expression
+	Distance int
+	// Regexp is true if Criteria is a regular expression
+	Regexp bool
+}
+
+// String describes the closest match, and marks the first rune of the
+// criteria that does not match
+func (cm ClosestMatch) String() string {
+	var b strings.Builder
+	criteria := fmt.Sprintf("%q", cm.Criteria)
+	if cm.Regexp {
+		criteria = "/" + cm.Criteria + "/"
+	}
+	switch {
+	case cm.Prefix == utf8.RuneCountInString(cm.Criteria):
+		fmt.Fprintf(&b, "closest match for %s on row %d (in output matched before):\n", criteria, cm.Row)
+	case cm.Regexp:
+		fmt.Fprintf(&b, "closest match for %s on row %d (the pattern matches up to ^):\n", criteria, cm.Row)
+	default:
+		fmt.Fprintf(&b, "closest match for %s on row %d (edit distance %d):\n", criteria, cm.Row, cm.Distance)
+	}
+	prefix := string([]rune(cm.Criteria)[:cm.Prefix])
+	fmt.Fprintf(&b, "  found:    %s\n", escapeNewlines(cm.Text))
+	fmt.Fprintf(&b, "  expected: %s\n", escapeNewlines(cm.Criteria))
+	fmt.Fprintf(&b, "            %s^", strings.Repeat(" ", utf8.RuneCountInString(escapeNewlines(prefix))))
+	return b.String()
+}
+
+func escapeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// screenText is the text of the visible screen with the lines separated by
+// "\n" and the automatic line wraps removed
+type screenText struct {
+	text []rune
+	// rows holds the screen row of each rune of text
+	rows []int
+}
+
+// newScreenText returns the text of the visible screen of st
+func newScreenText(st *vt10x.State) *screenText {
+	st.Lock()
+	_, cy := st.Cursor()
+	_, gy := st.GlobalCursor()
+	rows, wrapped := st.Lines(gy - cy)
+	st.Unlock()
+	for len(rows) > 0 && strings.TrimSpace(rows[len(rows)-1]) == "" {
+		rows, wrapped = rows[:len(rows)-1], wrapped[:len(wrapped)-1]
+	}
+
+	s := &screenText{}
+	for y, row := range rows {
+		if !wrapped[y] {
+			row = strings.TrimRight(row, " ")
+		}
+		for _, r := range row {
+			s.text = append(s.text, r)
+			s.rows = append(s.rows, y)
+		}
+		if !wrapped[y] && y < len(rows)-1 {
+			s.text = append(s.text, '\n')
+			s.rows = append(s.rows, y)
+		}
+	}
+	return s
+}
+
+// withoutSpaces returns the text without spaces and newlines
+func (s *screenText) withoutSpaces() *screenText {
+	res := &screenText{}
+	for i, r := range s.text {
+		if r != ' ' && r != '\n' {
+			res.text = append(res.text, r)
+			res.rows = append(res.rows, s.rows[i])
+		}
+	}
+	return res
+}
+
+// closestMatches returns the closest matches on the screen for the string and
+// regular expression conditions among matchers
+func closestMatches(matchers []Matcher, screen *screenText) []ClosestMatch {
+	var res []ClosestMatch
+	for _, m := range matchers {
+		var cm *ClosestMatch
+		switch m := m.(type) {
+		case *callbackMatcher:
+			res = append(res, closestMatches([]Matcher{m.matcher}, screen)...)
+		case *anyMatcher:
+			res = append(res, closestMatches(m.options.Matchers, screen)...)
+		case *allMatcher:
+			res = append(res, closestMatches(m.options.Matchers, screen)...)
+		case *sequenceMatcher:
+			if m.step < len(m.steps) {
+				res = append(res, closestMatches(m.steps[m.step].Matchers, screen)...)
+			}
+		case *stringMatcher:
+			cm = closestString(m.str, m.ignoreNewlinesAndSpaces, screen)
+		case *regexpMatcher:
+			cm = closestRegexp(m.re, screen)
+		case WrappingMatcher:
+			res = append(res, closestMatches([]Matcher{m.Unwrap()}, screen)...)
+		}
+		if cm != nil {
+			res = append(res, *cm)
+		}
+	}
+	return res
+}
+
+// closestString returns the substring of the screen with the smallest edit
+// distance to str, or nil if it differs in more than half of the runes of str
+func closestString(str string, ignoreNewlinesAndSpaces bool, screen *screenText) *ClosestMatch {
+	expected := []rune(str)
+	if ignoreNewlinesAndSpaces {
+		expected = []rune(strings.NewReplacer(" ", "", "\n", "", "\r", "").Replace(str))
+		screen = screen.withoutSpaces()
+	}
+	if len(expected) == 0 || len(screen.text) == 0 {
+		return nil
+	}
+
+	// dist[i] is the edit distance between the first i runes of expected and
+	// the best substring of the text ending at the current position, which
+	// starts at start[i]
+	m := len(expected)
+	dist := make([]int, m+1)
+	start := make([]int, m+1)
+	for i := range dist {
+		dist[i] = i
+	}
+	// the substring only spans several lines if str does
+	multiline := strings.ContainsRune(str, '\n') && !ignoreNewlinesAndSpaces
+	best, bestStart, bestEnd := m+1, 0, 0
+	for j, r := range screen.text {
+		if r == '\n' && !multiline {
+			for i := range dist {
+				dist[i], start[i] = i, j+1
+			}
+			continue
+		}
+		diag, diagStart := dist[0], start[0]
+		dist[0], start[0] = 0, j+1
+		for i := 1; i <= m; i++ {
+			d, s := diag, diagStart
+			if expected[i-1] != r {
+				d++
+			}
+			if dist[i]+1 < d {
+				d, s = dist[i]+1, start[i]
+			}
+			if dist[i-1]+1 < d {
+				d, s = dist[i-1]+1, start[i-1]
+			}
+			diag, diagStart = dist[i], start[i]
+			dist[i], start[i] = d, s
+		}
+		// later output is preferred, as it is closer to the cursor, and of
+		// the substrings with the same start the one closest in length to str
+		better := dist[m] < best ||
+			dist[m] == best && start[m] > bestStart ||
+			dist[m] == best && start[m] == bestStart && abs(j+1-start[m]-m) < abs(bestEnd-bestStart-m)
+		if dist[m] < m && better {
+			best, bestStart, bestEnd = dist[m], start[m], j+1
+		}
+	}
+	if best*2 > m {
+		return nil
+	}
+
+	text := screen.text[bestStart:bestEnd]
+	prefix := 0
+	for prefix < len(text) && prefix < m && text[prefix] == expected[prefix] {
+		prefix++
+	}
+	return &ClosestMatch{
+		Criteria: string(expected),
+		Text:     string(text),
+		Row:      screen.rows[bestStart],
+		Prefix:   prefix,
+		Distance: best,
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// closestRegexp returns the last match on the screen of the longest prefix of
+// the pattern of re that is a valid regular expression and matches, or nil if
+// no prefix of at least half of the pattern matches any text
+func closestRegexp(re *regexp.Regexp, screen *screenText) *ClosestMatch {
+	pattern := []rune(re.String())
+	text := string(screen.text)
+	for n := len(pattern); n > 0 && n*2 >= len(pattern); n-- {
+		prefix, err := regexp.Compile(string(pattern[:n]))
+		if err != nil {
+			continue
+		}
+		locs := prefix.FindAllStringIndex(text, -1)
+		if len(locs) == 0 || locs[len(locs)-1][1] == locs[len(locs)-1][0] {
+			continue
+		}
+		loc := locs[len(locs)-1]
+		return &ClosestMatch{
+			Criteria: re.String(),
+			Text:     text[loc[0]:loc[1]],
+			Row:      screen.rows[utf8.RuneCountInString(text[:loc[0]])],
+			Prefix:   n,
+			Distance: -1,
+			Regexp:   true,
+		}
+	}
+	return nil
+}
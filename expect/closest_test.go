@@ -0,0 +1,94 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClosestMatch(t *testing.T) {
+	output := "Downloading foo\r\nSuccesfully installed foo 1.2\r\nDone in 3s\r\n"
+
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		expected []ClosestMatch
+	}{
+		{
+			"typo in a string",
+			String("Successfully installed foo"),
+			[]ClosestMatch{{Criteria: "Successfully installed foo", Text: "Succesfully installed foo", Row: 1, Prefix: 6, Distance: 1}},
+		},
+		{
+			"changed wording",
+			String("Done in 3 seconds"),
+			[]ClosestMatch{{Criteria: "Done in 3 seconds", Text: "Done in 3s", Row: 2, Prefix: 9, Distance: 7}},
+		},
+		{
+			"long string",
+			LongString("Succesfully installed bar"),
+			[]ClosestMatch{{Criteria: "Succesfullyinstalledbar", Text: "Succesfullyinstalledfoo", Row: 1, Prefix: 20, Distance: 3}},
+		},
+		{
+			"regular expression",
+			RegexpPattern(`Succesfully installed foo \d+\.\d+\.\d+`),
+			[]ClosestMatch{{Criteria: `Succesfully installed foo \d+\.\d+\.\d+`, Text: "Succesfully installed foo 1.2", Row: 1, Prefix: 34, Distance: -1, Regexp: true}},
+		},
+		{
+			"nothing similar",
+			String("Permission denied"),
+			nil,
+		},
+		{
+			"several conditions",
+			Any(String("Downloading bar"), String("Permission denied")),
+			[]ClosestMatch{{Criteria: "Downloading bar", Text: "Downloading foo", Row: 0, Prefix: 12, Distance: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			frames := []Frame{{Data: []byte(output)}, {Delay: time.Hour}}
+			c, err := NewReplayConsole(NewReplayReader(frames), WithTermCols(40), WithTermRows(5))
+			require.NoError(t, err)
+			defer c.Close()
+
+			_, err = c.Expect(tt.opt, WithTimeout(50*time.Millisecond))
+			var timeoutErr *ExpectTimeoutError
+			require.True(t, errors.As(err, &timeoutErr), "expected an ExpectTimeoutError, got %v", err)
+			require.Equal(t, tt.expected, timeoutErr.Closest)
+		})
+	}
+}
+
+func TestClosestMatchString(t *testing.T) {
+	cm := ClosestMatch{Criteria: "Successfully installed foo", Text: "Succesfully installed foo", Row: 1, Prefix: 6, Distance: 1}
+	expected := `closest match for "Successfully installed foo" on row 1 (edit distance 1):
+  found:    Succesfully installed foo
+  expected: Successfully installed foo
+                  ^`
+	require.Equal(t, expected, cm.String())
+
+	cm = ClosestMatch{Criteria: `installed \d+ packages`, Text: "installed 12", Row: 3, Prefix: 13, Distance: -1, Regexp: true}
+	expected = `closest match for /installed \d+ packages/ on row 3 (the pattern matches up to ^):
+  found:    installed 12
+  expected: installed \d+ packages
+                         ^`
+	require.Equal(t, expected, cm.String())
+}
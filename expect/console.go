@@ -16,12 +16,14 @@ package expect
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/ActiveState/termtest/expect/internal/osutils"
@@ -34,10 +36,18 @@ import (
 // input back on it's tty. Console can also multiplex other sources of input
 // and multiplex its output to other writers.
 type Console struct {
-	opts       ConsoleOpts
+	opts ConsoleOpts
+	// Backend is the terminal that the Console reads output from and sends input to
+	Backend Backend
+	// Pty is the pseudo-terminal of the Console, it is nil if the Backend is not an *xpty.Xpty
 	Pty        *xpty.Xpty
 	MatchState *MatchState
 	closers    []io.Closer
+	// pending holds output that has been read from the tty, but not processed yet
+	pending bytes.Buffer
+	readBuf []byte
+	// resized is 1 if the terminal has been resized and no output has been processed since
+	resized int32
 }
 
 type coord struct {
@@ -52,6 +62,12 @@ type MatchState struct {
 	// Buf is a buffer of the raw characters parsed since the last match
 	Buf        *bytes.Buffer
 	prevCoords []coord
+	// bulk is true if the output is processed in chunks rather than rune by rune
+	bulk bool
+	// matchEnd is the end of the text that has been matched, if it is not the cursor position
+	matchEnd *coord
+	// trimmed is the number of rows that have been dropped from the scrollback history
+	trimmed int
 }
 
 // UnwrappedStringToCursorFromMatch returns the parsed string from the position of the n-last match to the cursor position
@@ -69,10 +85,93 @@ func (ms *MatchState) UnwrappedStringToCursorFromMatch(n int) string {
 
 func (ms *MatchState) markMatch() {
 	c := coord{}
-	c.x, c.y = ms.TermState.GlobalCursor()
+	if ms.matchEnd != nil {
+		c = *ms.matchEnd
+	} else {
+		c.x, c.y = ms.TermState.GlobalCursor()
+	}
 	ms.prevCoords = append(ms.prevCoords, c)
 }
 
+// lastMatch returns the position of the last match
+func (ms *MatchState) lastMatch() coord {
+	if len(ms.prevCoords) == 0 {
+		return coord{}
+	}
+	return ms.prevCoords[len(ms.prevCoords)-1]
+}
+
+// shift moves the positions of previous matches up by n lines, after n lines
+// have been dropped from the scrollback history.  Positions in the dropped
+// lines move to the start of the history.
+func (ms *MatchState) shift(n int) {
+	ms.trimmed += n
+	move := func(c *coord) {
+		c.y -= n
+		if c.y < 0 {
+			*c = coord{}
+		}
+	}
+	for i := range ms.prevCoords {
+		move(&ms.prevCoords[i])
+	}
+	if ms.matchEnd != nil {
+		move(ms.matchEnd)
+	}
+}
+
+// unmatchedOutput returns true if the cursor has moved since the last match
+func (ms *MatchState) unmatchedOutput() bool {
+	var c coord
+	c.x, c.y = ms.TermState.GlobalCursor()
+	return c != ms.lastMatch()
+}
+
+// setMatchEnd records that a matcher matched the text from the last match up
+// to n runes into the unwrapped string returned by
+// UnwrappedStringToCursorFromMatch(0).  If several matchers match, the match
+// ends with the text matched last.
+func (ms *MatchState) setMatchEnd(n int) {
+	_, cols := ms.TermState.Size()
+	start := ms.lastMatch()
+	pos := start.x + n
+	end := coord{x: pos % cols, y: start.y + pos/cols}
+	if end.x == 0 && pos > 0 {
+		// like the cursor, a match ending in the last column stays on its row
+		end = coord{x: cols, y: end.y - 1}
+	}
+	if ms.matchEnd == nil || endsBefore(ms.matchEnd, &end) {
+		ms.matchEnd = &end
+	}
+}
+
+// Backend is the terminal device of a Console.  It transports the output of an
+// application to the Console and the input from the Console to the
+// application, and holds the virtual terminal that the Console writes the
+// output to.  An *xpty.Xpty is a Backend, either on a pseudo-terminal or on a
+// stream (see xpty.NewStream).
+type Backend interface {
+	// ReadContext reads raw terminal output into b.  It returns a timeout error
+	// if the deadline set by SetReadDeadline passes, or the context's error if
+	// ctx is done before any output could be read.
+	ReadContext(ctx context.Context, b []byte) (int, error)
+	// SetReadDeadline sets the deadline for the next reads, a zero value
+	// means that reads do not time out.
+	SetReadDeadline(d time.Time)
+	// TerminalInPipe returns the writer that input is sent to.
+	TerminalInPipe() io.Writer
+	// Resize changes the size of the terminal.
+	Resize(cols, rows uint16) error
+	// Terminal returns the virtual terminal that the Console writes the
+	// output to.  Replies of the virtual terminal to queries of the
+	// application should be sent back to the application.
+	Terminal() *vt10x.VT
+	// TerminalState returns the state of the virtual terminal.
+	TerminalState() *vt10x.State
+	// Close closes the terminal and the virtual terminal.
+	Close() error
+}
+
 // ConsoleOpt allows setting Console options.
 type ConsoleOpt func(*ConsoleOpts) error
 
@@ -87,6 +186,16 @@ type ConsoleOpts struct {
 	ReadTimeout     *time.Duration
 	TermCols        int
 	TermRows        int
+	// StreamOutput is read instead of the output of a pseudo-terminal if it is not nil
+	StreamOutput io.Reader
+	// StreamInput receives the input of a stream, it is discarded if StreamInput is nil
+	StreamInput io.Writer
+	// Backend is used instead of a pseudo-terminal if it is not nil
+	Backend Backend
+	// MaxHistoryLines limits the number of lines kept in the scrollback history, zero means no limit
+	MaxHistoryLines int
+	// MaxHistoryBytes limits the memory used by the scrollback history, zero means no limit
+	MaxHistoryBytes int
 }
 
 // ExpectObserver provides an interface for a function callback that will
@@ -184,6 +293,38 @@ func WithTermRows(rows int) ConsoleOpt {
 	}
 }
 
+// WithStream makes the Console read the terminal output from r and write its
+// input to w, instead of using a pseudo-terminal.  If w is nil, the input is
+// discarded.  No process can be started in the terminal of a stream.
+func WithStream(r io.Reader, w io.Writer) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.StreamOutput = r
+		opts.StreamInput = w
+		return nil
+	}
+}
+
+// WithBackend makes the Console run on the terminal backend b instead of a
+// pseudo-terminal.  The Console closes b when it is closed.
+func WithBackend(b Backend) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.Backend = b
+		return nil
+	}
+}
+
+// WithHistoryLimit limits the scrollback history of the terminal to maxLines
+// lines and approximately maxBytes bytes of memory, such that long running
+// sessions do not accumulate all their output.  The oldest lines are dropped
+// first.  A limit of zero means no limit.
+func WithHistoryLimit(maxLines, maxBytes int) ConsoleOpt {
+	return func(opts *ConsoleOpts) error {
+		opts.MaxHistoryLines = maxLines
+		opts.MaxHistoryBytes = maxBytes
+		return nil
+	}
+}
+
 // NewConsole returns a new Console with the given options.
 func NewConsole(opts ...ConsoleOpt) (*Console, error) {
 	options := ConsoleOpts{
@@ -198,25 +339,25 @@ func NewConsole(opts ...ConsoleOpt) (*Console, error) {
 		}
 	}
 
-	var pty *xpty.Xpty
-	rows := uint16(options.TermRows)
-	cols := uint16(options.TermCols)
-	// On Windows we are adding an extra row, because the last row appears to be empty usually
-	if runtime.GOOS == "windows" {
-		rows++
-	}
-	pty, err := xpty.New(cols, rows, true)
-	if err != nil {
-		return nil, err
+	backend := options.Backend
+	if backend == nil {
+		var err error
+		backend, err = newPty(options)
+		if err != nil {
+			return nil, err
+		}
 	}
+	pty, _ := backend.(*xpty.Xpty)
 
 	c := &Console{
-		opts: options,
-		Pty:  pty,
+		opts:    options,
+		Backend: backend,
+		Pty:     pty,
 		MatchState: &MatchState{
-			TermState: pty.State,
+			TermState: backend.TerminalState(),
 		},
-		closers: append(options.Closers),
+		closers: options.Closers,
+		readBuf: make([]byte, 4096),
 	}
 
 	for _, stdin := range options.Stdins {
@@ -231,22 +372,56 @@ func NewConsole(opts ...ConsoleOpt) (*Console, error) {
 	return c, nil
 }
 
+// newPty opens the pseudo-terminal, or the stream, that the options ask for
+func newPty(options ConsoleOpts) (*xpty.Xpty, error) {
+	rows := uint16(options.TermRows)
+	cols := uint16(options.TermCols)
+	if options.StreamOutput != nil {
+		return xpty.NewStream(cols, rows, true, options.StreamOutput, options.StreamInput)
+	}
+	// On Windows we are adding an extra row, because the last row appears to be empty usually
+	if runtime.GOOS == "windows" {
+		rows++
+	}
+	return xpty.New(cols, rows, true)
+}
+
 // Tty returns Console's pts (slave part of a pty). A pseudoterminal, or pty is
 // a pair of pseudo-devices, one of which, the slave, emulates a real text
 // terminal device.
+// It returns nil if the Console does not run on a pseudo-terminal.
 func (c *Console) Tty() *os.File {
+	if c.Pty == nil {
+		return nil
+	}
 	return c.Pty.Tty()
 }
 
+// Resize changes the size of the terminal.  On a pseudo-terminal, the
+// application receives a SIGWINCH signal on Unix systems.  Use WaitForRedraw to
+// wait for the application to redraw its output.
+func (c *Console) Resize(cols, rows uint16) error {
+	if err := c.Backend.Resize(cols, rows); err != nil {
+		return err
+	}
+	c.Logf("console resize: %dx%d", cols, rows)
+	atomic.StoreInt32(&c.resized, 1)
+	return nil
+}
+
 // Write writes bytes b to Console's tty.
 func (c *Console) Write(b []byte) (int, error) {
 	c.Logf("console write: %q", b)
-	return c.Pty.TerminalInPipe().Write(b)
+	return c.Backend.TerminalInPipe().Write(b)
 }
 
 // Fd returns Console's file descripting referencing the master part of its
-// pty.
+// pty.  It returns an invalid file descriptor if the Console does not run on
+// a pseudo-terminal.
 func (c *Console) Fd() uintptr {
+	if c.Pty == nil {
+		return ^uintptr(0)
+	}
 	return c.Pty.TerminalOutFd()
 }
 
@@ -260,6 +435,9 @@ func (c *Console) CloseReaders() (err error) {
 		}
 	}
 
+	if c.Pty == nil {
+		return c.Backend.Close()
+	}
 	return c.Pty.CloseReaders()
 }
 
@@ -267,9 +445,11 @@ func (c *Console) CloseReaders() (err error) {
 // You may want to split this up to give the readers time to read all the data
 // until they reach the EOF error
 func (c *Console) Close() error {
-	err := c.Pty.CloseTTY()
-	if err != nil {
-		c.Logf("failed to close TTY: %v", err)
+	if c.Pty != nil {
+		err := c.Pty.CloseTTY()
+		if err != nil {
+			c.Logf("failed to close TTY: %v", err)
+		}
 	}
 
 	// close the readers reading from the TTY
@@ -278,14 +458,47 @@ func (c *Console) Close() error {
 
 // Send writes string s to Console's tty.
 func (c *Console) Send(s string) (int, error) {
+	return c.SendContext(context.Background(), s)
+}
+
+// SendContext is like Send, but it returns the context's error if ctx is done
+// before s could be written to Console's tty.
+func (c *Console) SendContext(ctx context.Context, s string) (int, error) {
 	c.Logf("console send: %q", s)
-	n, err := io.WriteString(c.Pty.TerminalInPipe(), s)
+	n, err := c.writeContext(ctx, s)
 	for _, observer := range c.opts.SendObservers {
 		observer(s, n, err)
 	}
 	return n, err
 }
 
+func (c *Console) writeContext(ctx context.Context, s string) (int, error) {
+	if ctx.Done() == nil {
+		return io.WriteString(c.Backend.TerminalInPipe(), s)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	// the write is left to finish in the background if ctx is done first
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.WriteString(c.Backend.TerminalInPipe(), s)
+		done <- result{n, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
 // SendLine writes string s to Console's tty with a trailing newline.
 func (c *Console) SendLine(s string) (int, error) {
 	return c.Send(fmt.Sprintf("%s\n", s))
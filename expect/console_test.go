@@ -0,0 +1,132 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ActiveState/termtest/xpty"
+	"github.com/ActiveState/vt10x"
+	"github.com/stretchr/testify/require"
+)
+
+// loopback is a Backend that echoes the input as terminal output
+type loopback struct {
+	*xpty.PassthroughPipe
+	w     *io.PipeWriter
+	vt    *vt10x.VT
+	state *vt10x.State
+}
+
+func newLoopback(cols, rows int) (*loopback, error) {
+	r, w := io.Pipe()
+	state := &vt10x.State{RecordHistory: true}
+	vt, err := vt10x.New(state, nil, w)
+	if err != nil {
+		return nil, err
+	}
+	vt.Resize(cols, rows)
+	return &loopback{
+		PassthroughPipe: xpty.NewPassthroughPipe(bufio.NewReader(r)),
+		w:               w,
+		vt:              vt,
+		state:           state,
+	}, nil
+}
+
+func (l *loopback) TerminalInPipe() io.Writer {
+	return l.w
+}
+
+func (l *loopback) Resize(cols, rows uint16) error {
+	l.vt.Resize(int(cols), int(rows))
+	return nil
+}
+
+func (l *loopback) Terminal() *vt10x.VT {
+	return l.vt
+}
+
+func (l *loopback) TerminalState() *vt10x.State {
+	return l.state
+}
+
+func (l *loopback) Close() error {
+	_ = l.w.Close()
+	return l.PassthroughPipe.Close()
+}
+
+func TestConsoleBackend(t *testing.T) {
+	lb, err := newLoopback(20, 5)
+	require.NoError(t, err)
+
+	c, err := NewConsole(WithBackend(lb), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Nil(t, c.Pty)
+	require.Nil(t, c.Tty())
+
+	_, err = c.Send("hello world")
+	require.NoError(t, err)
+	_, err = c.ExpectString("hello")
+	require.NoError(t, err)
+	_, err = c.Expect(String("world"))
+	require.NoError(t, err)
+
+	_, err = c.Expect(String("missing"), WithTimeout(50*time.Millisecond))
+	require.True(t, os.IsTimeout(err), "expected a timeout, got %v", err)
+
+	require.NoError(t, c.Backend.Resize(40, 5))
+	rows, cols := c.Backend.TerminalState().Size()
+	require.Equal(t, 5, rows)
+	require.Equal(t, 40, cols)
+}
+
+func TestConsoleResize(t *testing.T) {
+	lb, err := newLoopback(10, 3)
+	require.NoError(t, err)
+
+	c, err := NewConsole(WithBackend(lb), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Send("line 1\r\nline 2\r\nline 3\r\nlong line 4\r\n")
+	require.NoError(t, err)
+	_, err = c.ExpectString("long line 4")
+	require.NoError(t, err)
+
+	// the history lines are narrower than the terminal after the resize
+	require.NoError(t, c.Resize(20, 3))
+	rows, cols := c.Backend.TerminalState().Size()
+	require.Equal(t, 3, rows)
+	require.Equal(t, 20, cols)
+	require.Equal(t, []string{"line 1", "line 2", "line 3", "long line 4"}, c.History())
+	require.Contains(t, c.Backend.TerminalState().StringToCursorFrom(0, 0), "line 2")
+
+	// output received before the resize does not count as a redraw
+	_, err = c.Expect(WaitForRedraw(20*time.Millisecond), WithTimeout(100*time.Millisecond))
+	require.True(t, os.IsTimeout(err), "expected a timeout, got %v", err)
+
+	_, err = c.Send("redrawn")
+	require.NoError(t, err)
+	_, err = c.Expect(WaitForRedraw(20 * time.Millisecond))
+	require.NoError(t, err)
+	require.Contains(t, c.Backend.TerminalState().String(), "redrawn")
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExpectTimeoutError is returned by Expect if its conditions have not been met
+// before the timeout.  It satisfies os.IsTimeout, and errors.Is and errors.As
+// find the error returned by the reader in its chain.
+type ExpectTimeoutError struct {
+	// Criteria are the criteria of the conditions that have not been met
+	Criteria []string
+	// Elapsed is the time Expect has waited
+	Elapsed time.Duration
+	// Screen is the visible screen of the terminal
+	Screen string
+	// Buffer is the raw terminal output since the last match
+	Buffer string
+	// Closest holds the text on the screen that comes closest to each string
+	// and regular expression that has not been found
+	Closest []ClosestMatch
+	// Err is the error that ended the wait
+	Err error
+}
+
+func (e *ExpectTimeoutError) Error() string {
+	msg := fmt.Sprintf("timed out after %v waiting for %s: %v", e.Elapsed.Round(time.Millisecond), strings.Join(e.Criteria, ", "), e.Err)
+	for _, cm := range e.Closest {
+		msg += "\n" + cm.String()
+	}
+	return msg
+}
+
+func (e *ExpectTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout returns true, such that os.IsTimeout recognizes the error
+func (e *ExpectTimeoutError) Timeout() bool {
+	return true
+}
+
+// ProcessGoneError is returned by Expect if the terminal output has ended
+// before its conditions have been met, usually because the process writing to
+// the terminal has exited.
+type ProcessGoneError struct {
+	// Criteria are the criteria of the conditions that have not been met
+	Criteria []string
+	// Elapsed is the time Expect has waited
+	Elapsed time.Duration
+	// Screen is the visible screen of the terminal
+	Screen string
+	// Buffer is the raw terminal output since the last match
+	Buffer string
+	// ProcessState is the exit state of the process, if it is known to the
+	// caller that has started it
+	ProcessState *os.ProcessState
+	// Err is the error returned by the reader, e.g., io.EOF
+	Err error
+}
+
+func (e *ProcessGoneError) Error() string {
+	msg := fmt.Sprintf("terminal output ended while waiting for %s: %v", strings.Join(e.Criteria, ", "), e.Err)
+	if e.ProcessState != nil {
+		msg += fmt.Sprintf(" (process %v)", e.ProcessState)
+	}
+	return msg
+}
+
+func (e *ProcessGoneError) Unwrap() error {
+	return e.Err
+}
+
+// outputEnded returns true if the error err indicates that no more output
+// can be read from the terminal
+func outputEnded(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.EIO)
+}
+
+// CriteriaStrings returns the criteria of the matchers as strings, as they
+// are reported by the errors of Expect
+func CriteriaStrings(matchers []Matcher) []string {
+	criteria := make([]string, len(matchers))
+	for i, m := range matchers {
+		criteria[i] = fmt.Sprintf("%v", m.Criteria())
+	}
+	return criteria
+}
+
+// expectError converts the error err that has ended an Expect call that
+// started at start into an ExpectTimeoutError or a ProcessGoneError with the
+// state of the terminal
+func (c *Console) expectError(matchers []Matcher, start time.Time, err error) error {
+	switch {
+	case os.IsTimeout(err):
+		return &ExpectTimeoutError{
+			Criteria: CriteriaStrings(matchers),
+			Elapsed:  time.Since(start),
+			Screen:   c.Backend.TerminalState().String(),
+			Buffer:   c.MatchState.Buf.String(),
+			Closest:  closestMatches(matchers, newScreenText(c.Backend.TerminalState())),
+			Err:      err,
+		}
+	case outputEnded(err):
+		return &ProcessGoneError{
+			Criteria: CriteriaStrings(matchers),
+			Elapsed:  time.Since(start),
+			Screen:   c.Backend.TerminalState().String(),
+			Buffer:   c.MatchState.Buf.String(),
+			Err:      err,
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectTimeoutError(t *testing.T) {
+	lb, err := newLoopback(20, 5)
+	require.NoError(t, err)
+
+	var observed error
+	c, err := NewConsole(WithBackend(lb), WithDefaultTimeout(time.Second), WithExpectObserver(func(_ []Matcher, _ *MatchState, err error) {
+		observed = err
+	}))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Send("hello world")
+	require.NoError(t, err)
+	_, err = c.Expect(String("missing"), RegexpPattern(`\d+`), WithTimeout(50*time.Millisecond))
+	require.True(t, os.IsTimeout(err), "expected a timeout, got %v", err)
+	require.Contains(t, err.Error(), "i/o timeout")
+	require.Equal(t, err, observed)
+
+	var timeoutErr *ExpectTimeoutError
+	require.True(t, errors.As(err, &timeoutErr), "expected an ExpectTimeoutError, got %T", err)
+	require.Equal(t, []string{"missing", `\d+`}, timeoutErr.Criteria)
+	require.GreaterOrEqual(t, int64(timeoutErr.Elapsed), int64(50*time.Millisecond))
+	require.Contains(t, timeoutErr.Screen, "hello world")
+	require.Equal(t, "hello world", timeoutErr.Buffer)
+}
+
+func TestProcessGoneError(t *testing.T) {
+	c, err := NewReplayConsole(NewReplayReader([]Frame{{Data: []byte("goodbye\r\n")}}), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.ExpectString("missing")
+	require.True(t, errors.Is(err, io.EOF), "expected EOF, got %v", err)
+	require.False(t, os.IsTimeout(err))
+
+	var gone *ProcessGoneError
+	require.True(t, errors.As(err, &gone), "expected a ProcessGoneError, got %T", err)
+	require.Equal(t, []string{"missing"}, gone.Criteria)
+	require.Contains(t, gone.Screen, "goodbye")
+	require.Equal(t, "goodbye\r\n", gone.Buffer)
+	require.Nil(t, gone.ProcessState)
+
+	// the end of the output can still be expected explicitly
+	_, err = c.Expect(EOF)
+	require.NoError(t, err)
+}
@@ -15,14 +15,22 @@
 package expect
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
+
+	"github.com/ActiveState/termtest/xpty"
 )
 
+// ErrUnwantedMatch is returned by Expect if a condition added with Never matched
+var ErrUnwantedMatch = errors.New("unwanted match")
+
 // Expectf reads from the Console's tty until the provided formatted string
 // is read or an error occurs, and returns the buffer read by Console.
 func (c *Console) Expectf(format string, args ...interface{}) (string, error) {
@@ -43,6 +51,12 @@ func (c *Console) ExpectLongString(s string) (string, error) {
 	return c.Expect(LongString(s))
 }
 
+// ExpectNotString reads from Console's tty for the duration d, and returns an
+// error if the provided string is read during that time.
+func (c *Console) ExpectNotString(s string, d time.Duration) (string, error) {
+	return c.Expect(Never(String(s), d))
+}
+
 // ExpectEOF reads from Console's tty until EOF or an error occurs, and returns
 // the buffer read by Console.  We also treat the PTSClosed error as an EOF.
 func (c *Console) ExpectEOF() (string, error) {
@@ -55,7 +69,22 @@ func (c *Console) ExpectEOF() (string, error) {
 // expecting input yet, it will be blocked. Sends are queued up in tty's
 // internal buffer so that the next Expect will read the remaining bytes (i.e.
 // rest of prompt) as well as its conditions.
+//
+// If all conditions are BulkMatchers, the output is fed to the terminal in the
+// chunks it is read in, and the conditions are evaluated once per chunk.  The
+// match then ends with the matched text, and the rest of the chunk is checked
+// by the next Expect call before it reads more output.  As that part of the
+// output has already been consumed, it is not included in the buffer returned
+// by the next call, and text that is overwritten within the same chunk may go
+// unnoticed.  Otherwise, the output is processed rune by rune and no runes past
+// the match are consumed.
 func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
+	return c.ExpectContext(context.Background(), opts...)
+}
+
+// ExpectContext is like Expect, but it stops reading and returns the context's
+// error as soon as ctx is done.
+func (c *Console) ExpectContext(ctx context.Context, opts ...ExpectOpt) (string, error) {
 	var options ExpectOpts
 	for _, opt := range opts {
 		if err := opt(&options); err != nil {
@@ -64,14 +93,43 @@ func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
 	}
 
 	c.MatchState.Buf = new(bytes.Buffer)
+	c.MatchState.bulk = options.bulk()
+	c.MatchState.matchEnd = nil
 	writer := io.MultiWriter(append(c.opts.Stdouts, c.MatchState.Buf)...)
-	runeWriter := bufio.NewWriterSize(writer, utf8.UTFMax)
 
 	readTimeout := c.opts.ReadTimeout
 	if options.ReadTimeout != nil {
 		readTimeout = options.ReadTimeout
 	}
 
+	// a window of time in which conditions added with Never must not match
+	var windowEnd time.Time
+	// the condition added with WaitForStableScreen with the shortest quiet period
+	var stable *stableMatcher
+	var stableMatch Matcher
+	neverOnly := len(options.Matchers) > 0
+	for _, m := range options.Matchers {
+		inner := m
+		if cm, ok := m.(*callbackMatcher); ok {
+			inner = cm.matcher
+		}
+		if sm, ok := inner.(*stableMatcher); ok && (stable == nil || sm.quiet < stable.quiet) {
+			stable = sm
+			stableMatch = m
+		}
+		nm, ok := m.(*neverMatcher)
+		if !ok {
+			neverOnly = false
+			continue
+		}
+		if nm.window > 0 {
+			end := time.Now().Add(nm.window)
+			if windowEnd.IsZero() || end.Before(windowEnd) {
+				windowEnd = end
+			}
+		}
+	}
+
 	var matcher Matcher
 	var err error
 
@@ -79,43 +137,109 @@ func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
 		for _, observer := range c.opts.ExpectObservers {
 			if matcher != nil {
 				observer([]Matcher{matcher}, c.MatchState, err)
-				return
+				continue
 			}
 			observer(options.Matchers, c.MatchState, err)
 		}
 	}()
 
+	// The screen of the virtual terminal only changes when output is read or
+	// when it is resized, so both start a new quiet period
+	start := time.Now()
+	lastChange := start
+	rows, cols := c.Backend.TerminalState().Size()
+
+	// in bulk mode, the output after the previous match may already have been
+	// processed, so the conditions are evaluated before reading more output.
+	// Conditions on the history can match output that has been processed at
+	// any time.
+	recheck := c.MatchState.bulk && (c.MatchState.unmatchedOutput() || searchesHistory(options.Matchers))
+
 	for {
-		if readTimeout != nil {
-			c.Pty.SetReadDeadline(time.Now().Add(*readTimeout))
-		}
+		// output that ended with an incomplete rune is processed as it is
+		flush := false
+		if !recheck && !hasCompleteRune(c.pending.Bytes()) {
+			var deadline time.Time
+			if !windowEnd.IsZero() {
+				deadline = windowEnd
+			} else if readTimeout != nil && stable != nil {
+				deadline = start.Add(*readTimeout)
+			} else if readTimeout != nil {
+				deadline = time.Now().Add(*readTimeout)
+			}
+			if stable != nil {
+				quietEnd := lastChange.Add(stable.quiet)
+				if deadline.IsZero() || quietEnd.Before(deadline) {
+					deadline = quietEnd
+				}
+			}
+			if !deadline.IsZero() {
+				c.Backend.SetReadDeadline(deadline)
+			}
 
-		var r rune
-		r, _, err = c.Pty.ReadRune()
+			var n int
+			n, err = c.Backend.ReadContext(ctx, c.readBuf)
+			c.pending.Write(c.readBuf[:n])
+			if err != nil && c.pending.Len() > 0 && ctx.Err() == nil && !os.IsTimeout(err) {
+				flush = true
+				err = nil
+			}
+		}
 		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return c.MatchState.Buf.String(), err
+			}
+			if !windowEnd.IsZero() && os.IsTimeout(err) && !time.Now().Before(windowEnd) {
+				// nothing unwanted was read during the window
+				err = nil
+				break
+			}
+			if stable != nil && os.IsTimeout(err) && !time.Now().Before(lastChange.Add(stable.quiet)) {
+				if newRows, newCols := c.Backend.TerminalState().Size(); newRows != rows || newCols != cols {
+					rows, cols = newRows, newCols
+					lastChange = time.Now()
+					continue
+				}
+				if stable.redraw && atomic.LoadInt32(&c.resized) != 0 {
+					// the application has not redrawn its output yet
+					lastChange = time.Now()
+					continue
+				}
+				// the screen has been stable for the quiet period
+				matcher = stableMatch
+				err = nil
+				c.MatchState.markMatch()
+				break
+			}
 			matcher = options.Match(err)
 			if matcher != nil {
 				err = nil
 				break
 			}
+			if neverOnly && !os.IsTimeout(err) {
+				// the output ended without an unwanted match
+				err = nil
+				break
+			}
+			err = c.expectError(options.Matchers, start, err)
 			return c.MatchState.Buf.String(), err
 		}
 
-		c.Logf("expect read: %q", string(r))
-		_, err = runeWriter.WriteRune(r)
-		if err != nil {
-			return c.MatchState.Buf.String(), err
+		if !recheck {
+			lastChange = time.Now()
 		}
-
-		// Immediately flush rune to the underlying writers.
-		err = runeWriter.Flush()
+		recheck = false
+		matcher, err = c.process(writer, options, flush)
 		if err != nil {
 			return c.MatchState.Buf.String(), err
 		}
-
-		matcher = options.Match(c.MatchState)
 		if matcher != nil {
 			c.MatchState.markMatch()
+			if _, ok := matcher.(*neverMatcher); ok {
+				err = fmt.Errorf("%w: %v on row %d: %q", ErrUnwantedMatch, matcher.Criteria(), matchRow(c.MatchState), matchLine(c.MatchState))
+				return c.MatchState.Buf.String(), err
+			}
 			break
 		}
 	}
@@ -132,3 +256,80 @@ func (c *Console) Expect(opts ...ExpectOpt) (string, error) {
 
 	return c.MatchState.Buf.String(), err
 }
+
+// process feeds the pending output to the terminal and the writer, and
+// evaluates the conditions.  In bulk mode all complete runes are processed at
+// once, otherwise they are processed one by one until a condition matches.  If
+// flush is true, an incomplete rune at the end of the output is processed as
+// well.  Afterwards, the history is trimmed to its limits.
+func (c *Console) process(w io.Writer, options ExpectOpts, flush bool) (Matcher, error) {
+	defer c.trimHistory()
+
+	data := c.pending.Bytes()
+	n := len(data)
+	if !flush {
+		n = xpty.CompleteRunes(data)
+	}
+
+	if n > 0 {
+		atomic.StoreInt32(&c.resized, 0)
+	}
+
+	if c.MatchState.bulk && !flush {
+		if n > 0 {
+			c.Logf("expect read: %q", string(data[:n]))
+			c.Backend.Terminal().Write(data[:n])
+			_, err := w.Write(data[:n])
+			c.pending.Next(n)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return options.firstMatch(c.MatchState), nil
+	}
+
+	for n > 0 {
+		r, sz := utf8.DecodeRune(data)
+		c.Logf("expect read: %q", string(r))
+		c.Backend.Terminal().WriteRune(r)
+		_, err := w.Write(data[:sz])
+		c.pending.Next(sz)
+		if err != nil {
+			return nil, err
+		}
+		data, n = data[sz:], n-sz
+
+		if matcher := options.Match(c.MatchState); matcher != nil {
+			return matcher, nil
+		}
+	}
+	return nil, nil
+}
+
+// hasCompleteRune returns true if data starts with a complete rune
+func hasCompleteRune(data []byte) bool {
+	return len(data) > 0 && utf8.FullRune(data)
+}
+
+// matchRow returns the row of the visible screen on which the last match ended
+func matchRow(ms *MatchState) int {
+	_, cy := ms.TermState.Cursor()
+	_, gy := ms.TermState.GlobalCursor()
+	return ms.lastMatch().y - (gy - cy)
+}
+
+// matchLine returns the screen line on which the last match ended up to the
+// end of the match
+func matchLine(ms *MatchState) string {
+	y := matchRow(ms)
+	if y < 0 {
+		return ""
+	}
+	_, cols := ms.TermState.Size()
+	var line []rune
+	for x := 0; x < ms.lastMatch().x && x < cols; x++ {
+		ch, _, _ := ms.TermState.Cell(x, y)
+		line = append(line, ch)
+	}
+	return string(line)
+}
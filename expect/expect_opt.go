@@ -15,11 +15,13 @@
 package expect
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"regexp"
 	"syscall"
 	"time"
+	"unicode/utf8"
 )
 
 // ExpectOpt allows settings Expect options.
@@ -63,10 +65,19 @@ type ExpectOpts struct {
 	ReadTimeout *time.Duration
 }
 
+// bulk returns true if all matchers can be evaluated once per chunk of output
+func (eo ExpectOpts) bulk() bool {
+	return len(eo.Matchers) > 0 && allBulk(eo.Matchers)
+}
+
 // Match sequentially calls Match on all matchers in ExpectOpts and returns the
 // first matcher if a match exists, otherwise nil.
 func (eo ExpectOpts) Match(v interface{}) Matcher {
+	ms, _ := v.(*MatchState)
 	for _, matcher := range eo.Matchers {
+		if ms != nil {
+			ms.matchEnd = nil
+		}
 		if matcher.Match(v) {
 			return matcher
 		}
@@ -74,6 +85,35 @@ func (eo ExpectOpts) Match(v interface{}) Matcher {
 	return nil
 }
 
+// firstMatch calls Match on all matchers in ExpectOpts and returns the matcher
+// whose match ends first in the output processed since the last match, or nil
+// if none of them matches.  Matchers that do not record where their match
+// ends are assumed to match at the cursor position.
+func (eo ExpectOpts) firstMatch(ms *MatchState) Matcher {
+	var first Matcher
+	var firstEnd *coord
+	for _, matcher := range eo.Matchers {
+		ms.matchEnd = nil
+		if !matcher.Match(ms) {
+			continue
+		}
+		if first == nil || endsBefore(ms.matchEnd, firstEnd) {
+			first, firstEnd = matcher, ms.matchEnd
+		}
+	}
+	ms.matchEnd = firstEnd
+	return first
+}
+
+// endsBefore returns true if the match ending at a ends before the one ending
+// at b, where nil is the cursor position
+func endsBefore(a, b *coord) bool {
+	if a == nil {
+		return false
+	}
+	return b == nil || a.y < b.y || (a.y == b.y && a.x < b.x)
+}
+
 // CallbackMatcher is a matcher that provides a Callback function.
 type CallbackMatcher interface {
 	// Callback executes the matcher's callback with the terminal state at the
@@ -89,6 +129,41 @@ type Matcher interface {
 	Criteria() interface{}
 }
 
+// BulkMatcher is implemented by matchers that only inspect the terminal state
+// of a MatchState (and not the raw output in MatchState.Buf), and that still
+// find their match when more output has been processed after it.
+//
+// While all conditions of an Expect call are BulkMatchers, Console.Expect feeds
+// the output to the terminal in chunks and evaluates the matchers once per
+// chunk.  Otherwise, it processes the output rune by rune and stops right after
+// the first match.
+type BulkMatcher interface {
+	// Bulk returns true if the matcher can be evaluated once per chunk of output
+	Bulk() bool
+}
+
+// WrappingMatcher is implemented by matchers that match with another matcher
+// under additional conditions.  A timeout reports the closest matches of the
+// wrapped matcher.
+type WrappingMatcher interface {
+	// Unwrap returns the wrapped matcher
+	Unwrap() Matcher
+}
+
+func isBulk(m Matcher) bool {
+	bm, ok := m.(BulkMatcher)
+	return ok && bm.Bulk()
+}
+
+func allBulk(matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !isBulk(m) {
+			return false
+		}
+	}
+	return true
+}
+
 // callbackMatcher fulfills the Matcher and CallbackMatcher interface to match
 // using its embedded matcher and provide a callback function.
 type callbackMatcher struct {
@@ -104,6 +179,10 @@ func (cm *callbackMatcher) Criteria() interface{} {
 	return cm.matcher.Criteria()
 }
 
+func (cm *callbackMatcher) Bulk() bool {
+	return isBulk(cm.matcher)
+}
+
 func (cm *callbackMatcher) Callback(ms *MatchState) error {
 	cb, ok := cm.matcher.(CallbackMatcher)
 	if ok {
@@ -136,6 +215,10 @@ func (em *errorMatcher) Criteria() interface{} {
 	return em.err
 }
 
+func (em *errorMatcher) Bulk() bool {
+	return true
+}
+
 // pathErrorMatcher fulfills the Matcher interface to match a specific os.PathError.
 type pathErrorMatcher struct {
 	pathError os.PathError
@@ -157,6 +240,10 @@ func (em *pathErrorMatcher) Criteria() interface{} {
 	return em.pathError
 }
 
+func (em *pathErrorMatcher) Bulk() bool {
+	return true
+}
+
 type anyMatcher struct {
 	options ExpectOpts
 }
@@ -178,6 +265,62 @@ func (om *anyMatcher) Criteria() interface{} {
 	return criterias
 }
 
+func (om *anyMatcher) Bulk() bool {
+	return allBulk(om.options.Matchers)
+}
+
+// neverMatcher fulfills the Matcher interface to match a group of ExpectOpt that
+// must not match the content read from Console's tty.
+type neverMatcher struct {
+	options ExpectOpts
+	window  time.Duration
+}
+
+func (nm *neverMatcher) Match(v interface{}) bool {
+	for _, matcher := range nm.options.Matchers {
+		if matcher.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (nm *neverMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, matcher := range nm.options.Matchers {
+		criterias = append(criterias, matcher.Criteria())
+	}
+	return fmt.Sprintf("never %v", criterias)
+}
+
+func (nm *neverMatcher) Bulk() bool {
+	return allBulk(nm.options.Matchers)
+}
+
+// stableMatcher fulfills the Matcher interface to match if the terminal screen
+// has not changed for a quiet period.  It never matches content by itself, as
+// the quiet period is tracked by Console.Expect.
+type stableMatcher struct {
+	quiet time.Duration
+	// redraw is true if output has to be received after the terminal has been resized
+	redraw bool
+}
+
+func (sm *stableMatcher) Match(v interface{}) bool {
+	return false
+}
+
+func (sm *stableMatcher) Criteria() interface{} {
+	if sm.redraw {
+		return fmt.Sprintf("screen redrawn and stable for %v", sm.quiet)
+	}
+	return fmt.Sprintf("screen stable for %v", sm.quiet)
+}
+
+func (sm *stableMatcher) Bulk() bool {
+	return true
+}
+
 // stringMatcher fulfills the Matcher interface to match strings against a given
 // MatchState
 type stringMatcher struct {
@@ -190,6 +333,14 @@ func (sm *stringMatcher) Match(v interface{}) bool {
 	if !ok {
 		return false
 	}
+	if ms.bulk {
+		// the string can be anywhere in the output processed since the last match
+		end := indexEnd([]rune(ms.UnwrappedStringToCursorFromMatch(0)), []rune(sm.str), sm.ignoreNewlinesAndSpaces)
+		if end >= 0 {
+			ms.setMatchEnd(end)
+			return true
+		}
+	}
 	return ms.TermState.HasStringBeforeCursor(sm.str, sm.ignoreNewlinesAndSpaces)
 }
 
@@ -197,10 +348,57 @@ func (sm *stringMatcher) Criteria() interface{} {
 	return sm.str
 }
 
+func (sm *stringMatcher) Bulk() bool {
+	return true
+}
+
+// indexEnd returns the index after the first occurrence of str in text, or -1
+// if str is not present in text.  If ignoreNewlinesAndSpaces is true, spaces and
+// empty cells in text and spaces and newlines in str are skipped over.
+func indexEnd(text, str []rune, ignoreNewlinesAndSpaces bool) int {
+	// positions maps the runes of the compared text to their index in text
+	var positions []int
+	if ignoreNewlinesAndSpaces {
+		compared := make([]rune, 0, len(text))
+		positions = make([]int, 0, len(text))
+		for i, r := range text {
+			if r != ' ' && r != 0 {
+				compared = append(compared, r)
+				positions = append(positions, i)
+			}
+		}
+		text = compared
+
+		expected := make([]rune, 0, len(str))
+		for _, r := range str {
+			if r != ' ' && r != '\n' && r != '\r' {
+				expected = append(expected, r)
+			}
+		}
+		str = expected
+	}
+
+	if len(str) == 0 {
+		return 0
+	}
+	for i := 0; i+len(str) <= len(text); i++ {
+		if text[i] != str[0] || string(text[i:i+len(str)]) != string(str) {
+			continue
+		}
+		if positions != nil {
+			return positions[i+len(str)-1] + 1
+		}
+		return i + len(str)
+	}
+	return -1
+}
+
 // regexpMatcher fulfills the Matcher interface to match Regexp against a given
 // MatchState.
 type regexpMatcher struct {
 	re *regexp.Regexp
+	// submatch receives the capture groups of the match, if it is set
+	submatch *RegexpMatch
 }
 
 func (rm *regexpMatcher) Match(v interface{}) bool {
@@ -208,13 +406,32 @@ func (rm *regexpMatcher) Match(v interface{}) bool {
 	if !ok {
 		return false
 	}
-	return rm.re.MatchString(ms.UnwrappedStringToCursorFromMatch(0))
+	text := ms.UnwrappedStringToCursorFromMatch(0)
+	if !ms.bulk && rm.submatch == nil {
+		return rm.re.MatchString(text)
+	}
+
+	loc := rm.re.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return false
+	}
+	if rm.submatch != nil {
+		*rm.submatch = newRegexpMatch(rm.re, text, loc)
+	}
+	if ms.bulk {
+		ms.setMatchEnd(utf8.RuneCountInString(text[:loc[1]]))
+	}
+	return true
 }
 
 func (rm *regexpMatcher) Criteria() interface{} {
 	return rm.re
 }
 
+func (rm *regexpMatcher) Bulk() bool {
+	return true
+}
+
 // allMatcher fulfills the Matcher interface to match a group of ExpectOpt
 // against any value.
 type allMatcher struct {
@@ -234,6 +451,10 @@ func (am *allMatcher) Match(v interface{}) bool {
 	return len(matchers) == 0
 }
 
+func (am *allMatcher) Bulk() bool {
+	return allBulk(am.options.Matchers)
+}
+
 func (am *allMatcher) Criteria() interface{} {
 	var criterias []interface{}
 	for _, matcher := range am.options.Matchers {
@@ -242,6 +463,106 @@ func (am *allMatcher) Criteria() interface{} {
 	return criterias
 }
 
+// sequenceMatcher fulfills the Matcher interface to match a list of steps, each
+// in the output following the match of the previous step.
+type sequenceMatcher struct {
+	steps []ExpectOpts
+	// step is the index of the step that has not been matched yet
+	step int
+	// reached is the end of the match of the previous step
+	reached *coord
+}
+
+func (sm *sequenceMatcher) Match(v interface{}) bool {
+	ms, ok := v.(*MatchState)
+	if !ok {
+		return false
+	}
+	for sm.step < len(sm.steps) {
+		// the step only sees the output after the previous step
+		if sm.reached != nil {
+			ms.prevCoords = append(ms.prevCoords, *sm.reached)
+		}
+		matched := sm.steps[sm.step].firstMatch(ms) != nil
+		if sm.reached != nil {
+			ms.prevCoords = ms.prevCoords[:len(ms.prevCoords)-1]
+		}
+		cursor := coord{}
+		cursor.x, cursor.y = ms.TermState.GlobalCursor()
+		if matched && ms.matchEnd == nil && sm.reached != nil && *sm.reached == cursor {
+			// a match at the cursor has to include output after the previous step
+			matched = false
+		}
+		if !matched {
+			ms.matchEnd = nil
+			return false
+		}
+
+		sm.step++
+		if ms.matchEnd == nil {
+			// the step matched at the cursor, so the next step has to wait for more output
+			sm.reached = &cursor
+			if sm.step < len(sm.steps) {
+				return false
+			}
+			break
+		}
+		sm.reached = ms.matchEnd
+	}
+	ms.matchEnd = sm.reached
+	return true
+}
+
+func (sm *sequenceMatcher) Criteria() interface{} {
+	var criterias []interface{}
+	for _, step := range sm.steps {
+		if len(step.Matchers) == 1 {
+			criterias = append(criterias, step.Matchers[0].Criteria())
+			continue
+		}
+		var any []interface{}
+		for _, matcher := range step.Matchers {
+			any = append(any, matcher.Criteria())
+		}
+		criterias = append(criterias, any)
+	}
+	if sm.step == len(sm.steps) {
+		return fmt.Sprintf("sequence %v", criterias)
+	}
+	return fmt.Sprintf("sequence %v (reached step %d of %d: %v)", criterias, sm.step+1, len(sm.steps), criterias[sm.step])
+}
+
+func (sm *sequenceMatcher) Bulk() bool {
+	for _, step := range sm.steps {
+		if !allBulk(step.Matchers) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sequence adds an Expect condition to exit once the content read from
+// Console's tty matches each of the provided ExpectOpt in order: every
+// ExpectOpt has to match in the output following the match of the previous one.
+// An ExpectOpt with several conditions is met when any of them matches.  If the
+// Expect call fails, the criteria of the condition report the step that has
+// been reached.
+func Sequence(expectOpts ...ExpectOpt) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		sm := &sequenceMatcher{}
+		for _, opt := range expectOpts {
+			var options ExpectOpts
+			if err := opt(&options); err != nil {
+				return err
+			}
+			sm.steps = append(sm.steps, options)
+		}
+
+		opts.Matchers = append(opts.Matchers, sm)
+		return nil
+	}
+}
+
 // All adds an Expect condition to exit if the content read from Console's tty
 // matches all of the provided ExpectOpt, in any order.
 func All(expectOpts ...ExpectOpt) ExpectOpt {
@@ -260,6 +581,60 @@ func All(expectOpts ...ExpectOpt) ExpectOpt {
 	}
 }
 
+// Never adds an Expect condition that makes the Expect call fail with
+// ErrUnwantedMatch if the content read from Console's tty matches expectOpt.
+//
+// If the duration d is greater than zero, the Expect call succeeds once d has
+// passed without a match, and d replaces the read timeout. Without other
+// conditions, the Expect call also succeeds when the tty is closed. Otherwise it
+// succeeds as soon as one of the other conditions matches.
+func Never(expectOpt ExpectOpt, d time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		var options ExpectOpts
+		if err := expectOpt(&options); err != nil {
+			return err
+		}
+
+		// unwanted matches take precedence over all other conditions
+		opts.Matchers = append([]Matcher{&neverMatcher{
+			options: options,
+			window:  d,
+		}}, opts.Matchers...)
+		return nil
+	}
+}
+
+// WaitForStableScreen adds an Expect condition to exit once no output has been
+// read from Console's tty for the quiet period, and the terminal screen has not
+// changed during that time.
+//
+// Use it to wait until a program that redraws the screen repeatedly (like a TUI
+// or a spinner) has settled, before asserting the screen content.  Unlike the
+// other conditions, the read timeout applies to the whole Expect call and not
+// only to the next read.
+func WaitForStableScreen(quiet time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &stableMatcher{
+			quiet: quiet,
+		})
+		return nil
+	}
+}
+
+// WaitForRedraw adds an Expect condition that is met like the one of
+// WaitForStableScreen, but only after output has been received since the
+// terminal has last been resized with Console.Resize, i.e., once the
+// application has redrawn its output for the new size.
+func WaitForRedraw(quiet time.Duration) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &stableMatcher{
+			quiet:  quiet,
+			redraw: true,
+		})
+		return nil
+	}
+}
+
 // String adds an Expect condition to exit if the content read from Console's
 // tty contains any of the given strings.
 func String(strs ...string) ExpectOpt {
@@ -318,6 +693,23 @@ func RegexpPattern(ps ...string) ExpectOpt {
 	}
 }
 
+// RegexpSubmatch adds an Expect condition to exit if the content read from
+// Console's tty matches the given Regexp, and stores the text of the match and
+// of its capture groups in m once it matches.
+//
+// Note, that the condition is met as soon as the output matches, so a pattern
+// like `port (\d+)` may match before all digits have been printed.  Match the
+// text following the value as well, e.g., `port (\d+)\s`.
+func RegexpSubmatch(re *regexp.Regexp, m *RegexpMatch) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &regexpMatcher{
+			re:       re,
+			submatch: m,
+		})
+		return nil
+	}
+}
+
 // Error adds an Expect condition to exit if reading from Console's tty returns
 // one of the provided errors.
 func Error(errs ...error) ExpectOpt {
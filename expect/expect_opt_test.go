@@ -15,11 +15,12 @@
 package expect
 
 import (
-	"bytes"
 	"errors"
 	"io"
+	"os"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/ActiveState/vt10x"
 	"github.com/stretchr/testify/require"
@@ -76,7 +77,7 @@ func TestExpectOptString(t *testing.T) {
 			err := test.opt(&options)
 			require.Nil(t, err)
 
-			ms := mockMatchState(t, test.data)
+			ms := replayMatchState(t, test.data)
 			matcher := options.Match(ms)
 			if test.expected {
 				require.NotNil(t, matcher)
@@ -126,7 +127,7 @@ func TestExpectOptRegexp(t *testing.T) {
 			err := test.opt(&options)
 			require.Nil(t, err)
 
-			ms := mockMatchState(t, test.data)
+			ms := replayMatchState(t, test.data)
 			matcher := options.Match(ms)
 			if test.expected {
 				require.NotNil(t, matcher)
@@ -176,7 +177,7 @@ func TestExpectOptRegexpPattern(t *testing.T) {
 			err := test.opt(&options)
 			require.Nil(t, err)
 
-			ms := mockMatchState(t, test.data)
+			ms := replayMatchState(t, test.data)
 			matcher := options.Match(ms)
 			if test.expected {
 				require.NotNil(t, matcher)
@@ -236,21 +237,6 @@ func TestExpectOptError(t *testing.T) {
 	}
 }
 
-func mockMatchState(t *testing.T, data string) *MatchState {
-	buf := new(bytes.Buffer)
-	_, err := buf.WriteString(data)
-	require.NoError(t, err)
-
-	var st vt10x.State
-	st.RecordHistory = true
-	st.WriteString(data, 10, 80)
-
-	return &MatchState{
-		TermState: &st,
-		Buf:       buf,
-	}
-}
-
 func TestExpectOptThen(t *testing.T) {
 	var (
 		errFirst  = errors.New("first")
@@ -312,7 +298,7 @@ func TestExpectOptThen(t *testing.T) {
 			err := test.opt(&options)
 			require.Nil(t, err)
 
-			ms := mockMatchState(t, test.data)
+			ms := replayMatchState(t, test.data)
 
 			matcher := options.Match(ms)
 			if test.match {
@@ -407,7 +393,117 @@ func TestExpectOptAll(t *testing.T) {
 			err := test.opt(&options)
 			require.Nil(t, err)
 
-			ms := mockMatchState(t, test.data)
+			ms := replayMatchState(t, test.data)
+			matcher := options.Match(ms)
+			if test.expected {
+				require.NotNil(t, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+		})
+	}
+}
+
+func TestExpectOptNever(t *testing.T) {
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected bool
+	}{
+		{
+			"Unwanted string",
+			Never(String("panic"), time.Second),
+			"Oh no, panic",
+			true,
+		},
+		{
+			"No unwanted string",
+			Never(String("panic"), time.Second),
+			"Hello world",
+			false,
+		},
+		{
+			"Unwanted string takes precedence",
+			func(opts *ExpectOpts) error {
+				if err := String("world")(opts); err != nil {
+					return err
+				}
+				return Never(String("world"), 0)(opts)
+			},
+			"Hello world",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			ms := replayMatchState(t, test.data)
+			matcher := options.Match(ms)
+			if test.expected {
+				require.IsType(t, &neverMatcher{}, matcher)
+			} else {
+				require.Nil(t, matcher)
+			}
+		})
+	}
+}
+
+func TestExpectOptScreen(t *testing.T) {
+	const (
+		red      = "\x1b[31m"
+		bold     = "\x1b[1m"
+		reverse  = "\x1b[7m"
+		italic   = "\x1b[3m"
+		under    = "\x1b[4m"
+		bgBlue   = "\x1b[44m"
+		reset    = "\x1b[0m"
+		menuData = "Pick one:\r\n  apple\r\n" + reverse + "> banana" + reset + "\r\n  cherry"
+	)
+
+	tests := []struct {
+		title    string
+		opt      ExpectOpt
+		data     string
+		expected bool
+	}{
+		{"Cell char", Cell(1, 0, Char('i')), "Hi there", true},
+		{"Cell char mismatch", Cell(0, 0, Char('i')), "Hi there", false},
+		{"Cell fg", Cell(0, 0, FG(vt10x.Red)), red + "E" + reset, true},
+		{"Cell default fg", Cell(0, 0, FG(vt10x.Red)), "E", false},
+		{"Cell bold is bright", Cell(0, 0, Bold, FG(vt10x.LightRed)), bold + red + "E" + reset, true},
+		{"Cell bg", Cell(0, 0, BG(vt10x.Blue)), bgBlue + "E" + reset, true},
+		{"Cell italic", Cell(0, 0, Italic), italic + "E" + reset, true},
+		{"Cell underline", Cell(0, 0, Underline), under + "E" + reset, true},
+		{"Cell not underline", Cell(0, 0, Not(Underline)), "E", true},
+		{"Cell outside of screen", Cell(100, 0, Not(Bold)), "E", false},
+		{"Row text", Row(1, "world"), "Hello\r\nworld", true},
+		{"Row text on other row", Row(0, "world"), "Hello\r\nworld", false},
+		{"Row text with attributes", Row(0, "error", FG(vt10x.Red)), "an " + red + "error" + reset + " occurred", true},
+		{"Row text without attributes", Row(0, "error", FG(vt10x.Red)), "an error occurred, " + red + "sorry" + reset, false},
+		{"Row text with second occurrence", Row(0, "err", FG(vt10x.Red)), "err: " + red + "err" + reset, true},
+		{"Row all cells", Row(0, "", FG(vt10x.Red)), red + "all red" + reset, true},
+		{"Row not all cells", Row(0, "", FG(vt10x.Red)), red + "all" + reset + " red", false},
+		{"Row empty", Row(3, "", FG(vt10x.Red)), red + "all red" + reset, false},
+		{"Selected menu item", Row(2, "banana", Reverse), menuData, true},
+		{"Unselected menu item", Row(1, "apple", Reverse), menuData, false},
+		{"Region text", Region(0, 1, 10, 3, "cherry", Not(Reverse)), menuData, true},
+		{"Region clips text", Region(0, 1, 5, 3, "cherry"), menuData, false},
+		{"Region all cells", Region(0, 2, 8, 1, "", Reverse), menuData, true},
+		{"Region not all cells", Region(0, 1, 8, 2, "", Reverse), menuData, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			var options ExpectOpts
+			err := test.opt(&options)
+			require.Nil(t, err)
+
+			ms := replayMatchState(t, test.data)
 			matcher := options.Match(ms)
 			if test.expected {
 				require.NotNil(t, matcher)
@@ -417,3 +513,120 @@ func TestExpectOptAll(t *testing.T) {
 		})
 	}
 }
+
+// replayConsole returns a Console that replays the frames of data without delay
+func replayConsole(t *testing.T, data ...string) *Console {
+	frames := make([]Frame, len(data))
+	for i, d := range data {
+		frames[i] = Frame{Data: []byte(d)}
+	}
+	c, err := NewReplayConsole(NewReplayReader(frames), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// replayMatchState returns the match state of a Console that has replayed data to its end, such
+// that the conditions can be evaluated on all of data
+func replayMatchState(t *testing.T, data string) *MatchState {
+	c := replayConsole(t, data)
+	_, err := c.ExpectEOF()
+	require.NoError(t, err)
+	return c.MatchState
+}
+
+func TestExpectOptReplay(t *testing.T) {
+	tests := []struct {
+		title  string
+		opts   []ExpectOpt
+		frames []string
+		// rest is expected after the match
+		rest string
+		err  string
+	}{
+		{"String split across frames", []ExpectOpt{String("world")}, []string{"Hello wo", "rld"}, "", ""},
+		{"Rune split across frames", []ExpectOpt{String("wörld")}, []string{"Hello w\xc3", "\xb6rld"}, "", ""},
+		{"Regexp", []ExpectOpt{RegexpPattern(`id=\d+;`)}, []string{"id=4", "2; done"}, "done", ""},
+		{"Earliest match wins", []ExpectOpt{String("second"), String("first")}, []string{"first second"}, "second", ""},
+		{"Line break", []ExpectOpt{String("0123456789")}, []string{"01234", "\r\n", "56789"}, "", "EOF"},
+		{"Long wrapped text", []ExpectOpt{LongString("lorem ipsum\r\ndolor")}, []string{"lorem  ipsum", "\r\ndolor\r\n"}, "", ""},
+		{"Never", []ExpectOpt{Never(String("panic"), 0), String("done")}, []string{"oh no, panic: done"}, "", "panic"},
+		{"End of stream", []ExpectOpt{String("missing")}, []string{"Hello world"}, "", "EOF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			c := replayConsole(t, test.frames...)
+			_, err := c.Expect(test.opts...)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			if test.rest != "" {
+				_, err = c.Expect(String(test.rest))
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExpectOptSequence(t *testing.T) {
+	tests := []struct {
+		title  string
+		opt    ExpectOpt
+		frames []string
+		// rest is expected after the match
+		rest string
+		err  string
+	}{
+		{"In order", Sequence(String("Downloading"), String("Installing"), String("Done")), []string{"Downloading\r\nInstalling\r\nDone\r\n"}, "", ""},
+		{"Across frames", Sequence(String("Downloading"), String("Installing")), []string{"Download", "ing\r\nInst", "alling"}, "", ""},
+		{"Wrong order", Sequence(String("Downloading"), String("Installing"), String("Done")), []string{"Installing\r\nDownloading\r\nDone\r\n"}, "", "reached step 2 of 3: Installing"},
+		{"Repeated step", Sequence(String("ok"), String("ok")), []string{"ok ok"}, "", ""},
+		{"Repeated step missing", Sequence(String("ok"), String("ok")), []string{"ok"}, "", "reached step 2 of 2: ok"},
+		{"Alternatives", Sequence(String("start"), String("success", "failure")), []string{"start: failure"}, "", ""},
+		{"Regexp", Sequence(String("id="), RegexpPattern(`\d+;`)), []string{"42; id=7; done"}, "done", ""},
+		{"Rest after the last step", Sequence(String("one"), String("two")), []string{"one two three"}, "three", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			c := replayConsole(t, test.frames...)
+			_, err := c.Expect(test.opt)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			if test.rest != "" {
+				_, err = c.Expect(String(test.rest))
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestExpectReplayTiming(t *testing.T) {
+	frames := []Frame{
+		{Data: []byte("loading...")},
+		{Delay: 200 * time.Millisecond, Data: []byte("done")},
+	}
+
+	c, err := NewReplayConsole(NewReplayReader(frames))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Expect(String("loading"), WithTimeout(time.Second))
+	require.NoError(t, err)
+	_, err = c.Expect(String("done"), WithTimeout(50*time.Millisecond))
+	require.True(t, os.IsTimeout(err), "expected a timeout, got %v", err)
+	_, err = c.Expect(String("done"), WithTimeout(time.Second))
+	require.NoError(t, err)
+
+	// input to a replay is discarded
+	_, err = c.SendLine("ignored")
+	require.NoError(t, err)
+}
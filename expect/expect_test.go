@@ -18,9 +18,12 @@ package expect
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
 	"runtime/debug"
 	"strings"
 	"sync"
@@ -322,3 +325,272 @@ func TestConsoleChain(t *testing.T) {
 	testCloser(t, c1.Tty())
 	wg1.Wait()
 }
+
+func TestExpectNever(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		fmt.Fprint(c.Tty(), "starting\npanic: oops\n")
+	}()
+
+	_, err = c.Expect(Never(String("panic"), time.Second))
+	if !errors.Is(err, ErrUnwantedMatch) {
+		t.Fatalf("Expected error '%s' but got '%s' instead", ErrUnwantedMatch, err)
+	}
+	if !strings.Contains(err.Error(), `on row 1: "panic"`) {
+		t.Errorf("Expected error to report the offending row but got '%s'", err)
+	}
+}
+
+func TestExpectNeverWindow(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		fmt.Fprint(c.Tty(), "starting\n")
+	}()
+
+	start := time.Now()
+	_, err = c.ExpectNotString("panic", 200*time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected to read for 200ms, but returned after %v", elapsed)
+	}
+}
+
+func TestExpectNeverUntil(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		fmt.Fprint(c.Tty(), "starting\nready\npanic: too late\n")
+	}()
+
+	_, err = c.Expect(Never(String("panic"), 0), String("ready"))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	c.ExpectString("panic")
+}
+
+func TestExpectNeverEOF(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		fmt.Fprint(c.Tty(), "starting\n")
+		c.Tty().Close()
+	}()
+
+	_, err = c.ExpectNotString("panic", 10*time.Second)
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+}
+
+func TestExpectContext(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t, WithDefaultTimeout(10*time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = c.ExpectContext(ctx, String("What is 1+2?"))
+	if err != context.Canceled {
+		t.Errorf("Expected error '%s' but got '%s' instead", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected to return once the context was cancelled, but returned after %v", elapsed)
+	}
+}
+
+func TestSendContext(t *testing.T) {
+	t.Parallel()
+
+	var observed error
+	c, err := NewTestConsole(t, WithSendObserver(func(msg string, n int, err error) {
+		observed = err
+	}))
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n, err := c.SendContext(ctx, "hello")
+	if err != context.Canceled || n != 0 {
+		t.Errorf("Expected error '%s' and no bytes sent, but got '%s' and %d bytes", context.Canceled, err, n)
+	}
+	if observed != err {
+		t.Errorf("Expected send observer to receive '%s', got '%s'", err, observed)
+	}
+}
+
+func TestExpectStableScreen(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(c.Tty(), "\rworking %c", `|/-\`[i%4])
+			time.Sleep(20 * time.Millisecond)
+		}
+		fmt.Fprint(c.Tty(), "\rdone     \n")
+	}()
+
+	_, err = c.Expect(WaitForStableScreen(100*time.Millisecond), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Errorf("Expected no error but got '%s'", err)
+	}
+	if screen := c.Pty.State.String(); !strings.Contains(screen, "done") {
+		t.Errorf("Expected stable screen to contain 'done', got %q", screen)
+	}
+}
+
+func TestExpectStableScreenTimeout(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				fmt.Fprintf(c.Tty(), "\rworking %c", `|/-\`[i%4])
+			}
+		}
+	}()
+
+	start := time.Now()
+	_, err = c.Expect(WaitForStableScreen(100*time.Millisecond), WithTimeout(300*time.Millisecond))
+	if !os.IsTimeout(err) {
+		t.Errorf("Expected timeout error but got '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the timeout to apply to the whole call, but returned after %v", elapsed)
+	}
+}
+
+func TestExpectChunk(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	fmt.Fprint(c.Tty(), "foo\nbar 42\nbaz qux\n")
+
+	c.ExpectString("foo")
+	c.Expect(RegexpPattern(`bar \d+`))
+	c.ExpectLongString("baz\nqux")
+}
+
+// bufMatcher matches the raw output read by Expect
+type bufMatcher string
+
+func (bm bufMatcher) Match(v interface{}) bool {
+	ms, ok := v.(*MatchState)
+	return ok && strings.HasSuffix(ms.Buf.String(), string(bm))
+}
+
+func (bm bufMatcher) Criteria() interface{} {
+	return string(bm)
+}
+
+func TestExpectRawMatcher(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	fmt.Fprint(c.Tty(), "foo\nbar\n")
+
+	opt := func(str string) ExpectOpt {
+		return func(opts *ExpectOpts) error {
+			opts.Matchers = append(opts.Matchers, bufMatcher(str))
+			return nil
+		}
+	}
+
+	// no bytes past the match are consumed
+	buf, _ := c.Expect(opt("foo"))
+	if buf != "foo" {
+		t.Errorf("Expected to read %q, got %q", "foo", buf)
+	}
+	buf, _ = c.Expect(opt("bar"))
+	if buf != "\r\nbar" {
+		t.Errorf("Expected to read %q, got %q", "\r\nbar", buf)
+	}
+}
+
+func TestExpectSubmatch(t *testing.T) {
+	t.Parallel()
+
+	c, err := newTestConsole(t)
+	if err != nil {
+		t.Errorf("Expected no error but got'%s'", err)
+	}
+	defer testCloser(t, c)
+
+	fmt.Fprint(c.Tty(), "starting\nlistening on 127.0.0.1:8080\n")
+
+	m, err := c.ExpectSubmatch(regexp.MustCompile(`listening on (?P<host>[\d.]+):(?P<port>\d+)\s`))
+	if err != nil {
+		t.Fatalf("Expected no error but got '%s'", err)
+	}
+	if m.Groups[1] != "127.0.0.1" || m.Named["port"] != "8080" {
+		t.Errorf("Expected host 127.0.0.1 and port 8080, got %q", m.Groups)
+	}
+}
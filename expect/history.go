@@ -0,0 +1,225 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ActiveState/vt10x"
+)
+
+// HistoryLines returns the lines of the scrollback history of st followed by
+// the lines of the visible screen.  Lines that the terminal wrapped at its
+// width are joined, trailing spaces are removed, and empty lines at the end of
+// the screen are dropped.
+func HistoryLines(st *vt10x.State) []string {
+	st.Lock()
+	rows, wrapped := st.Lines(0)
+	st.Unlock()
+
+	lines, _ := joinRows(rows, wrapped)
+	return trimEmptyLines(lines)
+}
+
+// joinRows joins the rows that the terminal has wrapped at its width into
+// lines and removes their trailing spaces.  It also returns the index of the
+// first row of each line.
+func joinRows(rows []string, wrapped []bool) (lines []string, starts []int) {
+	var line strings.Builder
+	start := 0
+	for i, row := range rows {
+		if wrapped[i] {
+			line.WriteString(row)
+			continue
+		}
+		line.WriteString(strings.TrimRight(row, " "))
+		lines = append(lines, line.String())
+		starts = append(starts, start)
+		line.Reset()
+		start = i + 1
+	}
+	if start < len(rows) {
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+		starts = append(starts, start)
+	}
+	return lines, starts
+}
+
+// trimEmptyLines drops the empty lines at the end of lines
+func trimEmptyLines(lines []string) []string {
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// History returns the lines of the scrollback history and the visible screen
+// of the terminal, see HistoryLines.  The history only goes back as far as the
+// limits set with WithHistoryLimit allow.
+func (c *Console) History() []string {
+	return HistoryLines(c.Backend.TerminalState())
+}
+
+// SearchHistory returns the lines of the history that match re
+func (c *Console) SearchHistory(re *regexp.Regexp) []string {
+	var found []string
+	for _, line := range c.History() {
+		if re.MatchString(line) {
+			found = append(found, line)
+		}
+	}
+	return found
+}
+
+// trimHistory drops the oldest lines of the scrollback history that exceed
+// the limits of the Console, and moves the positions of previous matches
+// accordingly.
+func (c *Console) trimHistory() {
+	maxLines := c.opts.MaxHistoryLines
+	if c.opts.MaxHistoryBytes > 0 {
+		st := c.Backend.TerminalState()
+		st.Lock()
+		byteLimit := c.opts.MaxHistoryBytes / st.LineSize()
+		st.Unlock()
+		if maxLines <= 0 || byteLimit < maxLines {
+			maxLines = byteLimit
+		}
+	} else if maxLines <= 0 {
+		return
+	}
+
+	st := c.Backend.TerminalState()
+	st.Lock()
+	_, cy := st.Cursor()
+	_, gy := st.GlobalCursor()
+	n := 0
+	if gy-cy > maxLines {
+		n = st.TrimHistory(maxLines)
+	}
+	st.Unlock()
+	if n > 0 {
+		c.MatchState.shift(n)
+	}
+}
+
+// historyMatcher fulfills the Matcher interface to match strings or regular
+// expressions against the whole history of the terminal, including the output
+// before the last match.
+type historyMatcher struct {
+	str string
+	re  *regexp.Regexp
+	// overlap is the number of lines before the screen that are searched
+	// again, as a match may span them and the lines that are still changing
+	overlap int
+	// from is the row at which the next search starts.  It is counted from
+	// the first row of the history, including the rows that have been trimmed.
+	from int
+}
+
+// Match searches the lines from the row at which the previous call stopped.
+// Lines in the history do not change anymore, so the next call only searches
+// the lines from the start of the screen and the overlap before it.
+func (hm *historyMatcher) Match(v interface{}) bool {
+	ms, ok := v.(*MatchState)
+	if !ok {
+		return false
+	}
+	st := ms.TermState
+	st.Lock()
+	_, cy := st.Cursor()
+	_, gy := st.GlobalCursor()
+	historyRows := gy - cy
+	start := hm.from - ms.trimmed
+	if start < 0 || start > historyRows {
+		// the rows have been trimmed or the terminal has been reset
+		start = 0
+	}
+	rows, wrapped := st.Lines(start)
+	st.Unlock()
+
+	lines, starts := joinRows(rows, wrapped)
+	screen := sort.Search(len(starts), func(i int) bool {
+		return starts[i] > historyRows-start
+	}) - 1
+	if first := screen - hm.overlap; first > 0 {
+		hm.from = ms.trimmed + start + starts[first]
+	}
+
+	text := strings.Join(trimEmptyLines(lines), "\n")
+	if hm.re != nil {
+		return hm.re.MatchString(text)
+	}
+	return strings.Contains(text, hm.str)
+}
+
+func (hm *historyMatcher) Criteria() interface{} {
+	if hm.re != nil {
+		return fmt.Sprintf("history matching %v", hm.re)
+	}
+	return fmt.Sprintf("history containing %q", hm.str)
+}
+
+func (hm *historyMatcher) Bulk() bool {
+	return true
+}
+
+// searchesHistory returns true if any of the matchers is a condition on the
+// history
+func searchesHistory(matchers []Matcher) bool {
+	for _, m := range matchers {
+		if cm, ok := m.(*callbackMatcher); ok {
+			m = cm.matcher
+		}
+		if _, ok := m.(*historyMatcher); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryString adds an Expect condition to exit if the history of the
+// terminal contains any of the given strings.  Unlike String, it also finds
+// output that has been matched before, and the strings can span several lines
+// separated by "\n".
+func HistoryString(strs ...string) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		for _, str := range strs {
+			opts.Matchers = append(opts.Matchers, &historyMatcher{
+				str:     str,
+				overlap: strings.Count(str, "\n"),
+			})
+		}
+		return nil
+	}
+}
+
+// HistoryRegexp adds an Expect condition to exit if the history of the
+// terminal matches any of the given regular expressions.  The lines of the
+// history are separated by "\n".  A match can only span as many line breaks
+// as the pattern contains newlines, literally or as "\n".
+func HistoryRegexp(res ...*regexp.Regexp) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		for _, re := range res {
+			opts.Matchers = append(opts.Matchers, &historyMatcher{
+				re:      re,
+				overlap: strings.Count(re.String(), "\n") + strings.Count(re.String(), `\n`),
+			})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// numberedLines returns frames with the lines "line <from>" to "line <to>"
+func numberedLines(from, to int) []Frame {
+	var frames []Frame
+	for i := from; i <= to; i++ {
+		frames = append(frames, Frame{Data: []byte(fmt.Sprintf("line %d\r\n", i))})
+	}
+	return frames
+}
+
+func TestHistory(t *testing.T) {
+	frames := append(numberedLines(1, 8), Frame{Data: []byte(strings.Repeat("x", 25) + "\r\ndone")})
+	c, err := NewReplayConsole(NewReplayReader(frames), WithTermCols(20), WithTermRows(4), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.ExpectString("done")
+	require.NoError(t, err)
+
+	expected := []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", strings.Repeat("x", 25), "done"}
+	require.Equal(t, expected, c.History())
+	require.Equal(t, []string{"line 2", "line 3"}, c.SearchHistory(regexp.MustCompile(`^line [23]$`)))
+
+	// output before the last match is found in the history
+	_, err = c.Expect(HistoryString("line 1\nline 2"), WithTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = c.Expect(HistoryRegexp(regexp.MustCompile(`(?m)^x{25}$`)), WithTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+	_, err = c.Expect(HistoryString("line 9"), WithTimeout(100*time.Millisecond))
+	require.Error(t, err)
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tests := []struct {
+		title    string
+		maxLines int
+		maxBytes int
+		expected []string
+	}{
+		{"No limit", 0, 0, []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9", "line 10"}},
+		{"Lines", 3, 0, []string{"line 5", "line 6", "line 7", "line 8", "line 9", "line 10"}},
+		{"Bytes", 0, 1, []string{"line 8", "line 9", "line 10"}},
+		{"Lines and bytes", 5, 1 << 20, []string{"line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 9", "line 10"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			c, err := NewReplayConsole(
+				NewReplayReader(numberedLines(1, 10)),
+				WithTermCols(20), WithTermRows(4), WithDefaultTimeout(time.Second),
+				WithHistoryLimit(test.maxLines, test.maxBytes),
+			)
+			require.NoError(t, err)
+			defer c.Close()
+
+			// every line is processed separately, such that the history is trimmed in between
+			for i := 1; i <= 10; i++ {
+				_, err = c.ExpectString(fmt.Sprintf("line %d", i))
+				require.NoError(t, err)
+			}
+			_, err = c.ExpectEOF()
+			require.NoError(t, err)
+			require.Equal(t, test.expected, c.History())
+		})
+	}
+}
+
+func TestHistoryIncremental(t *testing.T) {
+	c, err := NewReplayConsole(NewReplayReader(numberedLines(1, 20)), WithTermCols(20), WithTermRows(4), WithDefaultTimeout(time.Second))
+	require.NoError(t, err)
+	defer c.Close()
+
+	hm := &historyMatcher{str: "line 17\nline 18", overlap: 1}
+	_, err = c.Expect(func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, hm)
+		return nil
+	}, String("never printed"))
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(c.MatchState.Buf.String(), "line 18\r\n"), "matched after line 18")
+	// the lines that have scrolled out of the screen are not searched again
+	require.True(t, hm.from > 10, "search starts at row %d", hm.from)
+
+	// the text is searched from the start for every Expect call
+	_, err = c.Expect(HistoryString("line 1\nline 2"), WithTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Frame is a chunk of recorded terminal output
+type Frame struct {
+	// Delay is the time between the previous frame (or the start of the
+	// replay) and this frame
+	Delay time.Duration
+	Data  []byte
+}
+
+// replayReader returns the data of frames after their delay
+type replayReader struct {
+	frames []Frame
+	data   []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewReplayReader returns a reader that returns the data of the frames, each
+// after its delay.  It returns io.EOF after the last frame, or once it has been
+// closed.
+func NewReplayReader(frames []Frame) io.ReadCloser {
+	return &replayReader{frames: frames, closed: make(chan struct{})}
+}
+
+func (r *replayReader) Read(b []byte) (int, error) {
+	for len(r.data) == 0 {
+		if len(r.frames) == 0 {
+			return 0, io.EOF
+		}
+		if r.frames[0].Delay > 0 {
+			t := time.NewTimer(r.frames[0].Delay)
+			select {
+			case <-t.C:
+			case <-r.closed:
+				t.Stop()
+				return 0, io.EOF
+			}
+		}
+		r.data = r.frames[0].Data
+		r.frames = r.frames[1:]
+	}
+	select {
+	case <-r.closed:
+		return 0, io.EOF
+	default:
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Close stops the replay
+func (r *replayReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+// NewReplayConsole returns a Console that reads the terminal output from r
+// instead of a pseudo-terminal, for example raw output that has been recorded
+// before.  Use NewReplayReader to replay the output with its original timing.
+// Input sent to the Console is discarded.
+func NewReplayConsole(r io.Reader, opts ...ConsoleOpt) (*Console, error) {
+	return NewConsole(append(opts, WithStream(r, nil))...)
+}
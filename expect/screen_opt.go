@@ -0,0 +1,260 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ActiveState/vt10x"
+)
+
+// ScreenCell is the content of a single cell of the visible terminal screen.
+//
+// The colors are stored the way vt10x renders them: Bold text in one of the
+// eight basic colors gets the bright variant of that color (vt10x.Red becomes
+// vt10x.LightRed), and the colors of reverse-video text are swapped.
+type ScreenCell struct {
+	Char      rune
+	FG, BG    vt10x.Color
+	Bold      bool
+	Underline bool
+	Reverse   bool
+	Italic    bool
+	Blink     bool
+}
+
+// CellAt returns the cell at position (x, y) relative to the top left of the
+// visible screen of the terminal state.
+func CellAt(st *vt10x.State, x, y int) ScreenCell {
+	ch, fg, bg := st.Cell(x, y)
+	attr := st.CellAttr(x, y)
+	return ScreenCell{
+		Char:      ch,
+		FG:        fg,
+		BG:        bg,
+		Bold:      attr&vt10x.AttrBold != 0,
+		Underline: attr&vt10x.AttrUnderline != 0,
+		Reverse:   attr&vt10x.AttrReverse != 0,
+		Italic:    attr&vt10x.AttrItalic != 0,
+		Blink:     attr&vt10x.AttrBlink != 0,
+	}
+}
+
+// blank returns true if the cell does not show a character
+func (c ScreenCell) blank() bool {
+	return c.Char == 0 || c.Char == ' '
+}
+
+// CellCondition is a condition on the content of a cell of the terminal screen
+type CellCondition struct {
+	name  string
+	match func(c ScreenCell) bool
+}
+
+func (cc CellCondition) String() string {
+	return cc.name
+}
+
+// Char is a CellCondition satisfied by cells showing the character r
+func Char(r rune) CellCondition {
+	return CellCondition{fmt.Sprintf("char %q", r), func(c ScreenCell) bool { return c.Char == r }}
+}
+
+// FG is a CellCondition satisfied by cells rendered in the foreground color
+// color
+func FG(color vt10x.Color) CellCondition {
+	return CellCondition{fmt.Sprintf("fg %d", color), func(c ScreenCell) bool { return c.FG == color }}
+}
+
+// BG is a CellCondition satisfied by cells rendered in the background color
+// color
+func BG(color vt10x.Color) CellCondition {
+	return CellCondition{fmt.Sprintf("bg %d", color), func(c ScreenCell) bool { return c.BG == color }}
+}
+
+// Not is a CellCondition satisfied by cells that do not satisfy cond
+func Not(cond CellCondition) CellCondition {
+	return CellCondition{"not " + cond.name, func(c ScreenCell) bool { return !cond.match(c) }}
+}
+
+var (
+	// Bold is a CellCondition satisfied by bold cells
+	Bold = CellCondition{"bold", func(c ScreenCell) bool { return c.Bold }}
+	// Underline is a CellCondition satisfied by underlined cells
+	Underline = CellCondition{"underline", func(c ScreenCell) bool { return c.Underline }}
+	// Reverse is a CellCondition satisfied by reverse-video cells
+	Reverse = CellCondition{"reverse", func(c ScreenCell) bool { return c.Reverse }}
+	// Italic is a CellCondition satisfied by italic cells
+	Italic = CellCondition{"italic", func(c ScreenCell) bool { return c.Italic }}
+	// Blink is a CellCondition satisfied by blinking cells
+	Blink = CellCondition{"blink", func(c ScreenCell) bool { return c.Blink }}
+)
+
+// cellsMatch returns true if all cells satisfy all conditions
+func cellsMatch(cells []ScreenCell, conds []CellCondition) bool {
+	for _, c := range cells {
+		for _, cond := range conds {
+			if !cond.match(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// regionMatcher fulfills the Matcher interface to match the text and text
+// attributes of a rectangular region of the visible screen against a given
+// MatchState.
+type regionMatcher struct {
+	x0, y0, x1, y1 int
+	str            []rune
+	conds          []CellCondition
+	criteria       string
+}
+
+func (rm *regionMatcher) Match(v interface{}) bool {
+	ms, ok := v.(*MatchState)
+	if !ok {
+		return false
+	}
+
+	rows, cols := ms.TermState.Size()
+	x0, y0 := max(rm.x0, 0), max(rm.y0, 0)
+	x1, y1 := min(rm.x1, cols), min(rm.y1, rows)
+	if x0 >= x1 || y0 >= y1 {
+		return false
+	}
+
+	if len(rm.str) == 0 {
+		// all non-blank cells of the region have to satisfy the conditions
+		var cells []ScreenCell
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				c := CellAt(ms.TermState, x, y)
+				if !c.blank() {
+					cells = append(cells, c)
+				}
+			}
+		}
+		return len(cells) > 0 && cellsMatch(cells, rm.conds)
+	}
+
+	for y := y0; y < y1; y++ {
+		row := make([]ScreenCell, 0, x1-x0)
+		for x := x0; x < x1; x++ {
+			row = append(row, CellAt(ms.TermState, x, y))
+		}
+		for i := 0; i+len(rm.str) <= len(row); i++ {
+			if textAt(row[i:], rm.str) && cellsMatch(row[i:i+len(rm.str)], rm.conds) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rm *regionMatcher) Criteria() interface{} {
+	return rm.criteria
+}
+
+func (rm *regionMatcher) Bulk() bool {
+	return true
+}
+
+// textAt returns true if the cells start with the characters of str
+func textAt(cells []ScreenCell, str []rune) bool {
+	for i, r := range str {
+		ch := cells[i].Char
+		if ch == 0 {
+			ch = ' '
+		}
+		if ch != r {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(str string, conds []CellCondition) string {
+	var parts []string
+	if str != "" {
+		parts = append(parts, fmt.Sprintf("contains %q", str))
+	}
+	for _, cond := range conds {
+		parts = append(parts, cond.name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Cell adds an Expect condition to exit if the cell at position (x, y) of the
+// visible screen satisfies all of the given conditions. Without conditions,
+// any non-blank cell satisfies it.
+func Cell(x, y int, conds ...CellCondition) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &regionMatcher{
+			x0: x, y0: y, x1: x + 1, y1: y + 1,
+			conds:    conds,
+			criteria: fmt.Sprintf("cell (%d,%d): %s", x, y, describe("", conds)),
+		})
+		return nil
+	}
+}
+
+// Row adds an Expect condition to exit if row y of the visible screen contains
+// str, and all cells showing str satisfy the given conditions. If str is
+// empty, all non-blank cells of the row have to satisfy the conditions.
+func Row(y int, str string, conds ...CellCondition) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &regionMatcher{
+			x0: 0, y0: y, x1: int(^uint(0) >> 1), y1: y + 1,
+			str:      []rune(str),
+			conds:    conds,
+			criteria: fmt.Sprintf("row %d: %s", y, describe(str, conds)),
+		})
+		return nil
+	}
+}
+
+// Region adds an Expect condition to exit if the rectangular region of the
+// visible screen with the top left corner (x, y) and the given width and
+// height contains str on one of its rows, and all cells showing str satisfy
+// the given conditions. If str is empty, all non-blank cells of the region
+// have to satisfy the conditions.
+func Region(x, y, width, height int, str string, conds ...CellCondition) ExpectOpt {
+	return func(opts *ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &regionMatcher{
+			x0: x, y0: y, x1: x + width, y1: y + height,
+			str:      []rune(str),
+			conds:    conds,
+			criteria: fmt.Sprintf("region (%d,%d) %dx%d: %s", x, y, width, height, describe(str, conds)),
+		})
+		return nil
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// RegexpMatch is the text matched by a regular expression and its capture
+// groups.  The text is taken from the unwrapped terminal output that the
+// expression was matched against.
+type RegexpMatch struct {
+	// Groups holds the text of the match followed by the text of the capture
+	// groups, like the result of regexp.FindStringSubmatch.  Groups that did not
+	// take part in the match are empty.
+	Groups []string
+	// Named maps the names of named capture groups that took part in the match
+	// to their text.
+	Named map[string]string
+}
+
+func newRegexpMatch(re *regexp.Regexp, text string, loc []int) RegexpMatch {
+	m := RegexpMatch{
+		Groups: make([]string, len(loc)/2),
+		Named:  make(map[string]string),
+	}
+	names := re.SubexpNames()
+	for i := range m.Groups {
+		if loc[2*i] < 0 {
+			continue
+		}
+		m.Groups[i] = text[loc[2*i]:loc[2*i+1]]
+		if names[i] != "" {
+			m.Named[names[i]] = m.Groups[i]
+		}
+	}
+	return m
+}
+
+// ExpectSubmatch reads from Console's tty until the output matches re or an
+// error occurs, and returns the text of the match and its capture groups.
+func (c *Console) ExpectSubmatch(re *regexp.Regexp, opts ...ExpectOpt) (*RegexpMatch, error) {
+	var m RegexpMatch
+	_, err := c.Expect(append([]ExpectOpt{RegexpSubmatch(re, &m)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Decode stores the text of the named capture groups in the fields of the
+// struct that v points to.  A field receives the group named by its `expect`
+// struct tag, or else the group with the name of the field.  Fields tagged
+// with `expect:"-"` and fields without a matching group are left unchanged.
+//
+// Fields can be strings, booleans, integers, floats, time.Durations or
+// implement encoding.TextUnmarshaler.
+func (m *RegexpMatch) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("decode requires a non-nil pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if field.PkgPath != "" {
+			// unexported field
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("expect"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		text, ok := m.Named[name]
+		if !ok {
+			continue
+		}
+		if err := setField(rv.Field(i), text); err != nil {
+			return fmt.Errorf("cannot decode group %s=%q into field %s: %w", name, text, field.Name, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses text into the value of a struct field
+func setField(f reflect.Value, text string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
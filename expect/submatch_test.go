@@ -0,0 +1,85 @@
+// Copyright 2020 ActiveState Software, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expect
+
+import (
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectOptRegexpSubmatch(t *testing.T) {
+	var m RegexpMatch
+	var options ExpectOpts
+	err := RegexpSubmatch(regexp.MustCompile(`id=(?P<id>\d+)(?: (?P<opt>x))?;`), &m)(&options)
+	require.NoError(t, err)
+
+	require.Nil(t, options.Match(replayMatchState(t, "id=12")))
+
+	require.NotNil(t, options.Match(replayMatchState(t, "id=42;")))
+	require.Equal(t, []string{"id=42;", "42", ""}, m.Groups)
+	require.Equal(t, map[string]string{"id": "42"}, m.Named)
+}
+
+func TestRegexpMatchDecode(t *testing.T) {
+	type result struct {
+		Name    string
+		Port    uint16 `expect:"port"`
+		Ratio   float64
+		Ready   bool
+		Timeout time.Duration
+		Addr    net.IP
+		Ignored string `expect:"-"`
+		Missing int
+	}
+
+	m := RegexpMatch{Named: map[string]string{
+		"Name":    "server",
+		"port":    "8080",
+		"Ratio":   "0.5",
+		"Ready":   "true",
+		"Timeout": "1m30s",
+		"Addr":    "127.0.0.1",
+		"Ignored": "value",
+	}}
+
+	res := result{Ignored: "unchanged", Missing: 7}
+	require.NoError(t, m.Decode(&res))
+	require.Equal(t, result{
+		Name:    "server",
+		Port:    8080,
+		Ratio:   0.5,
+		Ready:   true,
+		Timeout: 90 * time.Second,
+		Addr:    net.ParseIP("127.0.0.1"),
+		Ignored: "unchanged",
+		Missing: 7,
+	}, res)
+
+	// leading zeros do not select another base
+	m.Named["port"] = "0080"
+	require.NoError(t, m.Decode(&res))
+	require.Equal(t, uint16(80), res.Port)
+	m.Named["port"] = "010"
+	require.NoError(t, m.Decode(&res))
+	require.Equal(t, uint16(10), res.Port)
+
+	m.Named["port"] = "http"
+	require.Error(t, m.Decode(&res))
+	require.Error(t, m.Decode(res))
+}
@@ -24,7 +24,7 @@ import (
 // NewTestConsole returns a new Console that multiplexes the application's
 // stdout to go's testing logger. Primarily so that outputs from parallel tests
 // using t.Parallel() is not interleaved.
-func NewTestConsole(t *testing.T, opts ...ConsoleOpt) (*Console, error) {
+func NewTestConsole(t testing.TB, opts ...ConsoleOpt) (*Console, error) {
 	tf, err := NewTestWriter(t)
 	if err != nil {
 		return nil, err
@@ -35,7 +35,7 @@ func NewTestConsole(t *testing.T, opts ...ConsoleOpt) (*Console, error) {
 
 // NewTestWriter returns an io.Writer where bytes written to the file are
 // logged by go's testing logger. Bytes are flushed to the logger on line end.
-func NewTestWriter(t *testing.T) (io.Writer, error) {
+func NewTestWriter(t testing.TB) (io.Writer, error) {
 	r, w := io.Pipe()
 	tw := testWriter{t}
 
@@ -66,7 +66,7 @@ func NewTestWriter(t *testing.T) (io.Writer, error) {
 
 // testWriter provides a io.Writer interface to go's testing logger.
 type testWriter struct {
-	t *testing.T
+	t testing.TB
 }
 
 func (tw testWriter) Write(p []byte) (n int, err error) {
@@ -1,11 +1,14 @@
 module github.com/ActiveState/termtest
 
-go 1.14
+go 1.15
 
 require (
+	github.com/ActiveState/termtest/conpty v0.5.0
 	github.com/ActiveState/termtest/expect v0.7.0
+	github.com/ActiveState/termtest/xpty v0.6.0
 	github.com/ActiveState/vt10x v1.3.1
 	github.com/Netflix/go-expect v0.0.0-20201125194554-85d881c3777e // indirect
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/crypto v0.0.0-20200427165652-729f1e841bcc
 	golang.org/x/sys v0.0.0-20201201145000-ef89a241ccb3 // indirect
 )
@@ -6,7 +6,11 @@
 
 package osutils
 
-import "syscall"
+import (
+	"errors"
+	"syscall"
+	"time"
+)
 
 // SysProcAttrForNewProcessGroup returns a SysProcAttr structure configured to start a process with a new process group
 func SysProcAttrForNewProcessGroup() *syscall.SysProcAttr {
@@ -14,3 +18,38 @@ func SysProcAttrForNewProcessGroup() *syscall.SysProcAttr {
 		Setsid: true,
 	}
 }
+
+// TerminateSession terminates the process group and all other processes in the session of the
+// session leader sid with a SIGTERM signal.  Processes that are still running after the grace
+// period are killed.  This also terminates processes that the leader has started, after the leader
+// has exited.
+func TerminateSession(sid int, grace time.Duration) error {
+	if sid <= 1 {
+		return errors.New("invalid session id")
+	}
+	signal := func(sig syscall.Signal) bool {
+		procs, err := SessionProcesses(sid)
+		if err == nil && len(procs) == 0 {
+			// the session is gone, and the id may have been reused by an unrelated process
+			return false
+		}
+		_ = syscall.Kill(-sid, sig)
+		for _, p := range procs {
+			_ = syscall.Kill(p.Pid, sig)
+		}
+		return true
+	}
+
+	if !signal(syscall.SIGTERM) {
+		return nil
+	}
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if procs, err := SessionProcesses(sid); err == nil && len(procs) == 0 {
+			return nil
+		}
+	}
+	signal(syscall.SIGKILL)
+	return nil
+}
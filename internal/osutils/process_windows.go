@@ -6,7 +6,13 @@
 
 package osutils
 
-import "syscall"
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
 
 // SysProcAttrForNewProcessGroup returns a SysProcAttr structure configured to start a process with a new process group
 func SysProcAttrForNewProcessGroup() *syscall.SysProcAttr {
@@ -14,3 +20,15 @@ func SysProcAttrForNewProcessGroup() *syscall.SysProcAttr {
 		CreationFlags: 0x00000200, // CREATE_NEW_PROCESS_GROUP
 	}
 }
+
+// SessionProcesses is not supported on Windows
+func SessionProcesses(sid int) ([]ProcessInfo, error) {
+	return nil, errors.New("listing the processes of a session is not supported on Windows")
+}
+
+// TerminateSession kills the process sid and the processes it has started.  Windows processes
+// cannot be terminated gracefully, so grace is ignored, and processes whose parent has exited
+// cannot be found anymore.
+func TerminateSession(sid int, grace time.Duration) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(sid)).Run()
+}
@@ -0,0 +1,17 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package osutils
+
+import "fmt"
+
+// ProcessInfo describes a running process
+type ProcessInfo struct {
+	Pid     int
+	Command string
+}
+
+func (p ProcessInfo) String() string {
+	return fmt.Sprintf("%d: %s", p.Pid, p.Command)
+}
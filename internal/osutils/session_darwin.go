@@ -0,0 +1,43 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build darwin
+
+package osutils
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SessionProcesses returns the running processes in the process group of the session leader sid,
+// including the leader itself.  MacOS does not report the session of a process, so processes that
+// moved to another process group of the session are missing.
+func SessionProcesses(sid int) ([]ProcessInfo, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,pgid=,stat=,command=").Output()
+	if err != nil {
+		return nil, err
+	}
+	var res []ProcessInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		pgid, err := strconv.Atoi(fields[1])
+		if err != nil || pgid != sid || strings.HasPrefix(fields[2], "Z") {
+			continue
+		}
+		res = append(res, ProcessInfo{Pid: pid, Command: strings.Join(fields[3:], " ")})
+	}
+	return res, scanner.Err()
+}
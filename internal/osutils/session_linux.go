@@ -0,0 +1,70 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build linux
+
+package osutils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SessionProcesses returns the running processes in the session of the session leader sid,
+// including the leader itself.  Processes that have exited, but not been reaped yet are skipped.
+func SessionProcesses(sid int) ([]ProcessInfo, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	var res []ProcessInfo
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		// the process may have exited in the meantime
+		stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue
+		}
+		state, session, comm, err := parseStat(stat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stat of process %d: %w", pid, err)
+		}
+		if session != sid || state == "Z" || state == "X" {
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+		command := strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+		if command == "" {
+			command = "[" + comm + "]"
+		}
+		res = append(res, ProcessInfo{Pid: pid, Command: command})
+	}
+	return res, nil
+}
+
+// parseStat returns the state, the session id and the command name from the contents of
+// /proc/<pid>/stat
+func parseStat(stat []byte) (state string, session int, comm string, err error) {
+	// the command name is in parentheses and can contain spaces and parentheses itself
+	start := bytes.IndexByte(stat, '(')
+	end := bytes.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", 0, "", fmt.Errorf("unexpected format: %q", stat)
+	}
+	comm = string(stat[start+1 : end])
+	// the fields after the command name are: state ppid pgrp session ...
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 4 {
+		return "", 0, "", fmt.Errorf("unexpected format: %q", stat)
+	}
+	session, err = strconv.Atoi(fields[3])
+	return fields[0], session, comm, err
+}
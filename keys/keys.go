@@ -0,0 +1,231 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// Package keys provides named key presses that can be sent to a terminal
+// application, like the arrow keys, function keys or Ctrl- and Alt-key
+// combinations.
+//
+// Some keys are encoded differently depending on the modes that the
+// application has enabled on its terminal: In application cursor mode
+// (DECCKM) the arrow keys send SS3 instead of CSI sequences, and in
+// application keypad mode (DECKPAM) the keypad keys send SS3 sequences instead
+// of the characters printed on them.
+package keys
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mode describes the terminal modes that influence the byte sequence sent
+// for a key press.
+type Mode struct {
+	// AppCursor is true if the application cursor keys mode is enabled
+	AppCursor bool
+	// AppKeypad is true if the application keypad mode is enabled
+	AppKeypad bool
+}
+
+// Key is a key or key combination that can be pressed on a terminal keyboard
+type Key struct {
+	name string
+	// seq is the sequence sent in normal mode
+	seq string
+	// appCursor is the sequence sent in application cursor mode (if it differs)
+	appCursor string
+	// appKeypad is the sequence sent in application keypad mode (if it differs)
+	appKeypad string
+}
+
+// String returns a human-readable name of the key
+func (k Key) String() string {
+	return k.name
+}
+
+// Sequence returns the byte sequence that a terminal sends for the key press
+// when the terminal is in mode m
+func (k Key) Sequence(m Mode) string {
+	if m.AppCursor && k.appCursor != "" {
+		return k.appCursor
+	}
+	if m.AppKeypad && k.appKeypad != "" {
+		return k.appKeypad
+	}
+	return k.seq
+}
+
+func key(name, seq string) Key {
+	return Key{name: name, seq: seq}
+}
+
+// cursorKey returns a key that sends CSI <c> normally and SS3 <c> in application cursor mode
+func cursorKey(name string, c byte) Key {
+	return Key{name: name, seq: "\x1b[" + string(c), appCursor: "\x1bO" + string(c)}
+}
+
+// Keys that do not depend on the terminal mode
+var (
+	Enter     = key("Enter", "\r")
+	Tab       = key("Tab", "\t")
+	ShiftTab  = key("Shift+Tab", "\x1b[Z")
+	Backspace = key("Backspace", "\x7f")
+	Escape    = key("Escape", "\x1b")
+	Space     = key("Space", " ")
+	Insert    = key("Insert", "\x1b[2~")
+	Delete    = key("Delete", "\x1b[3~")
+	PageUp    = key("PageUp", "\x1b[5~")
+	PageDown  = key("PageDown", "\x1b[6~")
+)
+
+// Cursor keys, they send different sequences in application cursor mode
+var (
+	Up    = cursorKey("Up", 'A')
+	Down  = cursorKey("Down", 'B')
+	Right = cursorKey("Right", 'C')
+	Left  = cursorKey("Left", 'D')
+	Home  = cursorKey("Home", 'H')
+	End   = cursorKey("End", 'F')
+)
+
+// Function keys
+var (
+	F1  = key("F1", "\x1bOP")
+	F2  = key("F2", "\x1bOQ")
+	F3  = key("F3", "\x1bOR")
+	F4  = key("F4", "\x1bOS")
+	F5  = key("F5", "\x1b[15~")
+	F6  = key("F6", "\x1b[17~")
+	F7  = key("F7", "\x1b[18~")
+	F8  = key("F8", "\x1b[19~")
+	F9  = key("F9", "\x1b[20~")
+	F10 = key("F10", "\x1b[21~")
+	F11 = key("F11", "\x1b[23~")
+	F12 = key("F12", "\x1b[24~")
+)
+
+// Ctrl-letter combinations
+var (
+	CtrlA = Ctrl('a')
+	CtrlB = Ctrl('b')
+	CtrlC = Ctrl('c')
+	CtrlD = Ctrl('d')
+	CtrlE = Ctrl('e')
+	CtrlF = Ctrl('f')
+	CtrlG = Ctrl('g')
+	CtrlH = Ctrl('h')
+	CtrlI = Ctrl('i')
+	CtrlJ = Ctrl('j')
+	CtrlK = Ctrl('k')
+	CtrlL = Ctrl('l')
+	CtrlM = Ctrl('m')
+	CtrlN = Ctrl('n')
+	CtrlO = Ctrl('o')
+	CtrlP = Ctrl('p')
+	CtrlQ = Ctrl('q')
+	CtrlR = Ctrl('r')
+	CtrlS = Ctrl('s')
+	CtrlT = Ctrl('t')
+	CtrlU = Ctrl('u')
+	CtrlV = Ctrl('v')
+	CtrlW = Ctrl('w')
+	CtrlX = Ctrl('x')
+	CtrlY = Ctrl('y')
+	CtrlZ = Ctrl('z')
+)
+
+// KPEnter is the Enter key on the numeric keypad
+var KPEnter = Key{name: "KP_Enter", seq: "\r", appKeypad: "\x1bOM"}
+
+// keypadSS3 maps the keys of the numeric keypad to the final byte of the SS3
+// sequence they send in application keypad mode
+var keypadSS3 = map[rune]byte{
+	'0': 'p', '1': 'q', '2': 'r', '3': 's', '4': 't',
+	'5': 'u', '6': 'v', '7': 'w', '8': 'x', '9': 'y',
+	'.': 'n', '+': 'k', '-': 'm', '*': 'j', '/': 'o', '=': 'X',
+}
+
+// Keypad returns the key labelled c on the numeric keypad.
+// Valid labels are the digits and the characters ".+-*/=", it panics for any other rune.
+func Keypad(c rune) Key {
+	final, ok := keypadSS3[c]
+	if !ok {
+		panic(fmt.Sprintf("keys: there is no keypad key labelled %q", c))
+	}
+	return Key{name: "KP_" + string(c), seq: string(c), appKeypad: "\x1bO" + string(final)}
+}
+
+// Ctrl returns the key combination of the Ctrl key and c.
+// c can be a letter (case-insensitive) or one of the characters "@[\]^_?".
+// It panics for any other rune.
+func Ctrl(c rune) Key {
+	u := unicode.ToUpper(c)
+	switch {
+	case u == '?':
+		return key("Ctrl+?", "\x7f")
+	case u >= '@' && u <= '_':
+		return key("Ctrl+"+string(u), string(u-'@'))
+	}
+	panic(fmt.Sprintf("keys: cannot combine %q with the Ctrl key", c))
+}
+
+// Alt returns the key combination of the Alt (Meta) key and c, which is sent
+// as an escape character followed by c
+func Alt(c rune) Key {
+	return key("Alt+"+string(c), "\x1b"+string(c))
+}
+
+// Text returns a Key that types the string s verbatim
+func Text(s string) Key {
+	return key(fmt.Sprintf("%q", s), s)
+}
+
+// named are the keys that Parse finds by their name
+var named = []Key{
+	Enter, Tab, ShiftTab, Backspace, Escape, Space, Insert, Delete, PageUp, PageDown,
+	Up, Down, Right, Left, Home, End,
+	F1, F2, F3, F4, F5, F6, F7, F8, F9, F10, F11, F12,
+	KPEnter,
+}
+
+// Parse returns the key with the given name, as returned by Key.String.
+// Names are case-insensitive, except for the character of an Alt+ combination, and
+// "Ctrl-", "Alt-" and "KP-" can be used instead of "Ctrl+", "Alt+" and "KP_".
+func Parse(name string) (Key, error) {
+	for _, k := range named {
+		if strings.EqualFold(k.name, name) {
+			return k, nil
+		}
+	}
+
+	prefix, c := splitModifier(name)
+	switch {
+	case strings.EqualFold(prefix, "Ctrl"):
+		u := unicode.ToUpper(c)
+		if u == '?' || (u >= '@' && u <= '_') {
+			return Ctrl(c), nil
+		}
+	case strings.EqualFold(prefix, "Alt") && c != utf8.RuneError:
+		return Alt(c), nil
+	case strings.EqualFold(prefix, "KP"):
+		if _, ok := keypadSS3[c]; ok {
+			return Keypad(c), nil
+		}
+	}
+	return Key{}, fmt.Errorf("keys: unknown key %q", name)
+}
+
+// splitModifier splits a key combination like "Ctrl+C" into the modifier and the character
+func splitModifier(name string) (string, rune) {
+	i := strings.IndexAny(name, "+-_")
+	if i <= 0 {
+		return "", utf8.RuneError
+	}
+	c, sz := utf8.DecodeRuneInString(name[i+1:])
+	if sz == 0 || i+1+sz != len(name) {
+		return "", utf8.RuneError
+	}
+	return name[:i], c
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package keys
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequence(t *testing.T) {
+	normal := Mode{}
+	appCursor := Mode{AppCursor: true}
+	appKeypad := Mode{AppKeypad: true}
+
+	cases := []struct {
+		name     string
+		key      Key
+		mode     Mode
+		expected string
+	}{
+		{"up", Up, normal, "\x1b[A"},
+		{"up app cursor", Up, appCursor, "\x1bOA"},
+		{"up app keypad", Up, appKeypad, "\x1b[A"},
+		{"home", Home, normal, "\x1b[H"},
+		{"end app cursor", End, appCursor, "\x1bOF"},
+		{"page up", PageUp, appCursor, "\x1b[5~"},
+		{"F1", F1, normal, "\x1bOP"},
+		{"F5", F5, normal, "\x1b[15~"},
+		{"F12", F12, appKeypad, "\x1b[24~"},
+		{"ctrl-r", CtrlR, normal, "\x12"},
+		{"ctrl-c", Ctrl('C'), normal, "\x03"},
+		{"ctrl-[", Ctrl('['), normal, "\x1b"},
+		{"ctrl-?", Ctrl('?'), normal, "\x7f"},
+		{"alt-b", Alt('b'), normal, "\x1bb"},
+		{"keypad 5", Keypad('5'), normal, "5"},
+		{"keypad 5 app keypad", Keypad('5'), appKeypad, "\x1bOu"},
+		{"keypad enter app keypad", KPEnter, appKeypad, "\x1bOM"},
+		{"text", Text("hello"), appCursor, "hello"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.key.Sequence(c.mode))
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, "Up", Up.String())
+	assert.Equal(t, "Ctrl+R", CtrlR.String())
+	assert.Equal(t, "Alt+b", Alt('b').String())
+	assert.Equal(t, "KP_7", Keypad('7').String())
+}
+
+func TestInvalidKeys(t *testing.T) {
+	assert.Panics(t, func() { Ctrl('1') })
+	assert.Panics(t, func() { Keypad('a') })
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected Key
+	}{
+		{"Enter", Enter},
+		{"pageup", PageUp},
+		{"Shift+Tab", ShiftTab},
+		{"F10", F10},
+		{"KP_Enter", KPEnter},
+		{"Ctrl+C", CtrlC},
+		{"ctrl-r", CtrlR},
+		{"Ctrl+[", Ctrl('[')},
+		{"Alt+B", Alt('B')},
+		{"alt-b", Alt('b')},
+		{"KP_5", Keypad('5')},
+		{"KP-+", Keypad('+')},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			k, err := Parse(c.name)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, k)
+		})
+	}
+
+	for _, name := range []string{"", "Foo", "Ctrl+1", "Ctrl+CC", "KP_a", "Alt+"} {
+		_, err := Parse(name)
+		assert.Error(t, err, "parsing %q", name)
+	}
+}
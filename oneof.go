@@ -0,0 +1,130 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+)
+
+// Case is one of the possible outcomes of ExpectOneOf
+type Case struct {
+	// Opt is the condition of the case, e.g., expect.String("Overwrite? [y/N]")
+	// Conditions added with expect.Never are not supported.
+	Opt expect.ExpectOpt
+	// Handler is called after the condition has matched, e.g., to answer a prompt.  It may be nil.
+	Handler func() error
+	// Continue makes ExpectOneOf wait for the next match of any case after the handler has
+	// returned, instead of returning
+	Continue bool
+}
+
+// ExpectOneOf listens to the terminal output until the condition of one of the cases matches, and calls
+// the handler of that case.  If the case continues, it waits for the next match of any case, such that
+// a variable number of prompts can be answered until a case that does not continue is reached.
+// If several conditions match, the case whose match ends first in the output wins.
+// Once a case has continued, it can only match again after more output has been read, such that
+// conditions that do not consume the output, e.g., on the screen, do not match over and over.
+// It returns the index of the case that has matched last, or -1 if no case has matched.
+// Default timeout is 10 seconds for each match
+func (cp *ConsoleProcess) ExpectOneOf(cases []Case, timeout ...time.Duration) (int, error) {
+	if len(cases) == 0 {
+		return -1, errors.New("no cases to expect")
+	}
+	matched := -1
+	// stale holds the cases that have matched since output has last been read
+	stale := make(map[int]bool)
+	for {
+		fired := -1
+		var opts []expect.ExpectOpt
+		for i, c := range cases {
+			i := i
+			opt := c.Opt
+			if stale[i] {
+				opt = afterNewOutput(opt)
+			}
+			opts = append(opts, opt.Then(func(*expect.MatchState) error {
+				fired = i
+				return nil
+			}))
+		}
+		if len(timeout) > 0 {
+			opts = append(opts, expect.WithTimeout(timeout[0]))
+		}
+
+		out, err := cp.expect(cp.ctx, opts...)
+		if err != nil {
+			return matched, err
+		}
+		if fired < 0 {
+			return matched, errors.New("no case has matched")
+		}
+		if out != "" {
+			stale = make(map[int]bool)
+		}
+		stale[fired] = true
+		matched = fired
+		c := cases[fired]
+		if c.Handler != nil {
+			if err := c.Handler(); err != nil {
+				return matched, fmt.Errorf("handler of case %d failed: %w", fired, err)
+			}
+		}
+		if !c.Continue {
+			return matched, nil
+		}
+	}
+}
+
+// afterNewOutput returns the condition opt, which only matches once output has been read by the
+// Expect call
+func afterNewOutput(opt expect.ExpectOpt) expect.ExpectOpt {
+	return func(opts *expect.ExpectOpts) error {
+		var options expect.ExpectOpts
+		if err := opt(&options); err != nil {
+			return err
+		}
+		for _, m := range options.Matchers {
+			opts.Matchers = append(opts.Matchers, &newOutputMatcher{m})
+		}
+		if options.ReadTimeout != nil {
+			opts.ReadTimeout = options.ReadTimeout
+		}
+		return nil
+	}
+}
+
+// newOutputMatcher matches with its embedded matcher, but only if output has been read since the
+// start of the Expect call.  Errors, like the end of the output, are not new output.
+type newOutputMatcher struct {
+	expect.Matcher
+}
+
+func (m *newOutputMatcher) Match(v interface{}) bool {
+	ms, ok := v.(*expect.MatchState)
+	if !ok || ms.Buf.Len() == 0 {
+		return false
+	}
+	return m.Matcher.Match(v)
+}
+
+func (m *newOutputMatcher) Bulk() bool {
+	bm, ok := m.Matcher.(expect.BulkMatcher)
+	return ok && bm.Bulk()
+}
+
+func (m *newOutputMatcher) Unwrap() expect.Matcher {
+	return m.Matcher
+}
+
+func (m *newOutputMatcher) Callback(ms *expect.MatchState) error {
+	if cb, ok := m.Matcher.(expect.CallbackMatcher); ok {
+		return cb.Callback(ms)
+	}
+	return nil
+}
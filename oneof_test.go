@@ -0,0 +1,95 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+	"github.com/ActiveState/termtest"
+)
+
+// overwriteCases answers the overwrite prompts of the tester with answer
+func overwriteCases(cp *termtest.ConsoleProcess, answer string, prompts *int) []termtest.Case {
+	return []termtest.Case{
+		{
+			Opt: expect.RegexpPattern(`Overwrite file\d+\.txt\? \[y/N\] `),
+			Handler: func() error {
+				*prompts++
+				cp.SendLine(answer)
+				return nil
+			},
+			Continue: true,
+		},
+		{Opt: expect.String("overwrote 3 files")},
+		{Opt: expect.String("aborted")},
+	}
+}
+
+func (suite *TermTestTestSuite) TestExpectOneOf() {
+	cp := suite.spawn(false, "-prompts", "3")
+	defer cp.Close()
+
+	var prompts int
+	matched, err := cp.ExpectOneOf(overwriteCases(cp, "y", &prompts), 10*time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(1, matched)
+	suite.Equal(3, prompts)
+	cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestExpectOneOfTerminalCase() {
+	cp := suite.spawn(false, "-prompts", "3")
+	defer cp.Close()
+
+	var prompts int
+	matched, err := cp.ExpectOneOf(overwriteCases(cp, "n", &prompts), 10*time.Second)
+	suite.Require().NoError(err)
+	suite.Equal(2, matched)
+	suite.Equal(1, prompts)
+	cp.ExpectExitCode(1, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestExpectOneOfTimeout() {
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-sleep")
+	defer cp.Close()
+
+	matched, err := cp.ExpectOneOf([]termtest.Case{
+		{Opt: expect.String("an expected string"), Continue: true},
+		{Opt: expect.String("never printed")},
+	}, 200*time.Millisecond)
+	suite.True(os.IsTimeout(err), "expected a timeout, got %v", err)
+	suite.Equal(0, matched)
+
+	// the continued case is still reported, although it has to wait for new output
+	var timeoutErr *expect.ExpectTimeoutError
+	suite.Require().True(errors.As(err, &timeoutErr), "expected an ExpectTimeoutError, got %T", err)
+	var criteria []string
+	for _, cm := range timeoutErr.Closest {
+		criteria = append(criteria, cm.Criteria)
+	}
+	suite.Contains(criteria, "an expected string")
+}
+
+func (suite *TermTestTestSuite) TestExpectOneOfHistoryCondition() {
+	cp := suite.spawnCustom(false, func([]expect.Matcher, *expect.MatchState, error) {}, "-sleep")
+	defer cp.Close()
+
+	// the history keeps containing the string, but the case only matches once
+	var count int
+	matched, err := cp.ExpectOneOf([]termtest.Case{
+		{
+			Opt:      expect.HistoryString("an expected string"),
+			Handler:  func() error { count++; return nil },
+			Continue: true,
+		},
+		{Opt: expect.String("never printed")},
+	}, 500*time.Millisecond)
+	suite.True(os.IsTimeout(err), "expected a timeout, got %v", err)
+	suite.Equal(0, matched)
+	suite.Equal(1, count)
+}
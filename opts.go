@@ -5,6 +5,7 @@
 package termtest
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"time"
@@ -29,6 +30,42 @@ type Options struct {
 	Args           []string
 	HideCmdLine    bool
 	ExtraOpts      []expect.ConsoleOpt
+	// LogWriter receives the messages about the process, e.g., the command line that is spawned.
+	// Defaults to os.Stdout.
+	LogWriter io.Writer
+	// CastFile is the path of an asciicast v2 file that the terminal output, input and resize events
+	// are recorded to.  The recording can be replayed with `asciinema play`.
+	// If not set, NewTest records to a temporary file that is only kept when the test fails.
+	CastFile string
+	// ArtifactsDir is the directory that NewTest writes the artifacts of the terminal session to
+	// when the test fails.  If not set, the artifacts are written to a sub-directory of
+	// $TERMTEST_ARTIFACTS_DIR named after the test, or to the temporary directory of the test,
+	// which is removed when the test ends.
+	ArtifactsDir string
+	// DumpEnvironment makes WriteArtifacts write the values of the environment variables of the
+	// process.  By default only their names are written, as the values may contain secrets.
+	DumpEnvironment bool
+	// MaxArtifactBytes limits the raw terminal output that is kept for the artifacts to its last
+	// bytes.  Defaults to one megabyte.
+	MaxArtifactBytes int
+	// MaxHistoryLines and MaxHistoryBytes limit the scrollback history of the terminal, such that
+	// long running sessions do not keep all their output in memory.  Zero means no limit.
+	MaxHistoryLines int
+	MaxHistoryBytes int
+	// KillGracePeriod is the time that the process and the processes it has started get to exit
+	// after a SIGTERM signal, before they are killed.  Defaults to one second.
+	KillGracePeriod time.Duration
+	// CheckLeakedProcesses makes NewTest fail the test if processes started by the process under
+	// test are still running when the test ends.  This is not supported on Windows.
+	CheckLeakedProcesses bool
+	// ShellIntegration configures the shell CmdName (bash, zsh, fish or sh) to mark its prompt, the
+	// output and the exit code of commands with OSC 133 sequences, see RunShellCommand.  The
+	// configuration is written to a temporary directory that is removed by CleanUp, and replaces the
+	// rc files of the user.
+	ShellIntegration bool
+
+	// shellDir is the directory holding the shell configuration of the shell integration
+	shellDir string
 }
 
 // Normalize fills in default options
@@ -37,6 +74,10 @@ func (opts *Options) Normalize() error {
 		opts.DefaultTimeout = time.Second * 20
 	}
 
+	if opts.KillGracePeriod == 0 {
+		opts.KillGracePeriod = time.Second
+	}
+
 	if opts.WorkDirectory == "" {
 		tmpDir, err := ioutil.TempDir("", "")
 		if err != nil {
@@ -53,11 +94,21 @@ func (opts *Options) Normalize() error {
 		opts.ObserveExpect = func([]expect.Matcher, *expect.MatchState, error) {}
 	}
 
+	if opts.LogWriter == nil {
+		opts.LogWriter = os.Stdout
+	}
+
 	return nil
 }
 
 // CleanUp cleans up the environment
 func (opts *Options) CleanUp() error {
+	if opts.shellDir != "" {
+		if err := os.RemoveAll(opts.shellDir); err != nil {
+			return err
+		}
+	}
+
 	if !opts.RetainWorkDir {
 		return os.RemoveAll(opts.WorkDirectory)
 	}
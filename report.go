@@ -0,0 +1,236 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+	"github.com/ActiveState/termtest/internal/osutils/stacktrace"
+)
+
+// ArtifactsDirEnv is the environment variable that sets the directory that NewTest writes failure
+// artifacts to, e.g., a directory that is uploaded by a CI system.  The artifacts of each test are
+// written to a sub-directory named after the test.
+const ArtifactsDirEnv = "TERMTEST_ARTIFACTS_DIR"
+
+// Names of the files written by WriteArtifacts
+const (
+	ArtifactScreen      = "screen.txt"
+	ArtifactScrollback  = "scrollback.txt"
+	ArtifactOutput      = "output.raw"
+	ArtifactInput       = "input.log"
+	ArtifactExpectation = "expectation.txt"
+	ArtifactEnvironment = "environment.txt"
+	ArtifactProcess     = "process.txt"
+)
+
+// defaultMaxOutputBytes is the amount of raw output that the failure report keeps if
+// Options.MaxArtifactBytes is not set
+const defaultMaxOutputBytes = 1 << 20
+
+// failureReport collects the information about a terminal session that is needed to investigate a
+// failed test
+type failureReport struct {
+	mu     sync.Mutex
+	start  time.Time
+	output *ringBuffer
+	input  bytes.Buffer
+
+	// the last expectation that could not be met
+	criteria []string
+	err      error
+	stack    string
+}
+
+// newFailureReport returns a report that keeps the last maxOutput bytes of the terminal output, or
+// the last megabyte if maxOutput is zero
+func newFailureReport(maxOutput int) *failureReport {
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxOutputBytes
+	}
+	return &failureReport{start: time.Now(), output: newRingBuffer(maxOutput)}
+}
+
+// Write records terminal output
+func (r *failureReport) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.output.Write(p)
+}
+
+// ringBuffer keeps the last bytes written to it, up to its capacity
+type ringBuffer struct {
+	data []byte
+	// next is the position in data that the next byte is written to
+	next int
+	full bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, size)}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= len(b.data) {
+		copy(b.data, p[n-len(b.data):])
+		b.next, b.full = 0, true
+		return n, nil
+	}
+	c := copy(b.data[b.next:], p)
+	if c < n {
+		copy(b.data, p[c:])
+		b.full = true
+	}
+	b.next = (b.next + n) % len(b.data)
+	if b.next == 0 {
+		b.full = true
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the bytes in the buffer, oldest first
+func (b *ringBuffer) Bytes() []byte {
+	if !b.full {
+		return append([]byte(nil), b.data[:b.next]...)
+	}
+	return append(append([]byte(nil), b.data[b.next:]...), b.data[:b.next]...)
+}
+
+// observeSend records terminal input, it can be used as a SendObserver
+func (r *failureReport) observeSend(msg string, num int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	fmt.Fprintf(&r.input, "%s +%.3fs %q", now.Format("15:04:05.000"), now.Sub(r.start).Seconds(), msg)
+	if num != len(msg) {
+		fmt.Fprintf(&r.input, " (%d bytes sent)", num)
+	}
+	if err != nil {
+		fmt.Fprintf(&r.input, " error: %v", err)
+	}
+	r.input.WriteString("\n")
+}
+
+// resize records a change of the terminal size in the input log
+func (r *failureReport) resize(cols, rows uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	fmt.Fprintf(&r.input, "%s +%.3fs resize %dx%d\n", now.Format("15:04:05.000"), now.Sub(r.start).Seconds(), cols, rows)
+}
+
+// observeExpect records an expectation that could not be met, it can be used as an ExpectObserver
+func (r *failureReport) observeExpect(matchers []expect.Matcher, _ *expect.MatchState, err error) {
+	if err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.criteria = expect.CriteriaStrings(matchers)
+	r.err = err
+	r.stack = stacktrace.Get().String()
+}
+
+// WriteArtifacts writes files describing the current state of the terminal session to the directory dir:
+// the rendered screen, the scrollback, the raw terminal output, a log of the input sent to the terminal,
+// the last expectation that could not be met, the environment, and the command line and exit status
+// of the process.  The command line is omitted if Options.HideCmdLine is set, and the values of the
+// environment variables unless Options.DumpEnvironment is set.
+func (cp *ConsoleProcess) WriteArtifacts(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+
+	st := cp.console.Pty.State
+	r := cp.report
+	r.mu.Lock()
+	files := map[string][]byte{
+		ArtifactScreen:      []byte(st.String()),
+		ArtifactScrollback:  []byte(st.StringToCursorFrom(0, 0)),
+		ArtifactOutput:      r.output.Bytes(),
+		ArtifactInput:       append([]byte(nil), r.input.Bytes()...),
+		ArtifactExpectation: []byte(r.expectation()),
+		ArtifactEnvironment: []byte(cp.environment()),
+		ArtifactProcess:     []byte(cp.processInfo()),
+	}
+	r.mu.Unlock()
+
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write artifact %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// expectation describes the last expectation that could not be met
+func (r *failureReport) expectation() string {
+	if r.err == nil {
+		return "All expectations have been met.\n"
+	}
+	return fmt.Sprintf("Expectation: '%s'\nError: %v\n\n%s\n", strings.Join(r.criteria, ", "), r.err, r.stack)
+}
+
+// environment returns the environment of the process, one variable per line
+// The values are redacted unless Options.DumpEnvironment is set.
+func (cp *ConsoleProcess) environment() string {
+	env := cp.opts.Environment
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append([]string(nil), env...)
+	if !cp.opts.DumpEnvironment {
+		for i, kv := range env {
+			if eq := strings.Index(kv, "="); eq >= 0 {
+				env[i] = kv[:eq+1] + "*****"
+			}
+		}
+	}
+	sort.Strings(env)
+	return strings.Join(env, "\n") + "\n"
+}
+
+// processInfo describes the command line, the working directory, the exit status and the resource
+// usage of the process
+func (cp *ConsoleProcess) processInfo() string {
+	status := "running"
+	resources := ""
+	select {
+	case <-cp.exited:
+		status = cp.cmd.ProcessState.String()
+		resources = fmt.Sprintf("Resources: %s\n", newExitStatus(cp.cmd.ProcessState, cp.started, cp.ended).resources())
+	default:
+	}
+
+	return fmt.Sprintf("Command: %s\nWork directory: %s\nStatus: %s\n%s", cp.cmdString, cp.opts.WorkDirectory, status, resources)
+}
+
+// testArtifactsDir returns the directory that NewTest writes the artifacts of the test t to
+// If neither Options.ArtifactsDir nor the ArtifactsDirEnv environment variable are set, a new
+// directory in the temporary directory of the test is used.
+func testArtifactsDir(t testing.TB, opts Options) string {
+	if opts.ArtifactsDir != "" {
+		return opts.ArtifactsDir
+	}
+	if dir := os.Getenv(ArtifactsDirEnv); dir != "" {
+		return filepath.Join(dir, sanitizeFileName(t.Name()))
+	}
+	return t.TempDir()
+}
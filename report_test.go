@@ -0,0 +1,121 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+	"github.com/ActiveState/termtest"
+)
+
+func (suite *TermTestTestSuite) TestWriteArtifacts() {
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:   termtest.TestSendObserveFn(suite.T()),
+		ObserveExpect: func([]expect.Matcher, *expect.MatchState, error) {},
+		CmdName:       suite.sessionTester,
+		Args:          []string{"-read-keys"},
+		Environment:   []string{"SECRET_TOKEN=hidden-from-the-log"},
+		HideCmdLine:   true,
+	})
+	suite.Require().NoError(err)
+	defer cp.Close()
+
+	_, err = cp.Expect("waiting for keys", 10*time.Second)
+	suite.Require().NoError(err)
+	cp.SendUnterminated("hello\n")
+	_, err = cp.Expect(`received keys: "hello\n"`, 10*time.Second)
+	suite.Require().NoError(err)
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(err)
+	_, err = cp.Expect("never printed", 100*time.Millisecond)
+	suite.Require().Error(err)
+
+	dir := filepath.Join(suite.tmpDir, "artifacts")
+	suite.Require().NoError(cp.WriteArtifacts(dir))
+
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		suite.Require().NoError(err)
+		return string(b)
+	}
+	suite.Contains(read(termtest.ArtifactScreen), "waiting for keys")
+	suite.Contains(read(termtest.ArtifactScrollback), "waiting for keys")
+	suite.Contains(read(termtest.ArtifactOutput), "\x1b[?1h")
+	suite.Contains(read(termtest.ArtifactInput), `"hello\n"`)
+	suite.Contains(read(termtest.ArtifactExpectation), "Expectation: 'never printed'")
+	suite.Contains(read(termtest.ArtifactEnvironment), "SECRET_TOKEN=*****")
+	suite.NotContains(read(termtest.ArtifactEnvironment), "hidden-from-the-log")
+
+	process := read(termtest.ArtifactProcess)
+	suite.Contains(process, "Command: *****")
+	suite.NotContains(process, suite.sessionTester)
+	suite.Contains(process, "Status: exit status 0")
+	suite.Contains(process, "Resources: wall time ")
+}
+
+func (suite *TermTestTestSuite) TestWriteArtifactsOptions() {
+	cp, err := termtest.New(termtest.Options{
+		ObserveSend:      termtest.TestSendObserveFn(suite.T()),
+		ObserveExpect:    termtest.TestExpectObserveFn(suite.T()),
+		CmdName:          suite.sessionTester,
+		Args:             []string{"-stutter"},
+		Environment:      []string{"DEBUG_LEVEL=verbose"},
+		DumpEnvironment:  true,
+		MaxArtifactBytes: 64,
+	})
+	suite.Require().NoError(err)
+	defer cp.Close()
+
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(err)
+
+	dir := filepath.Join(suite.tmpDir, "artifacts-options")
+	suite.Require().NoError(cp.WriteArtifacts(dir))
+
+	env, err := ioutil.ReadFile(filepath.Join(dir, termtest.ArtifactEnvironment))
+	suite.Require().NoError(err)
+	suite.Contains(string(env), "DEBUG_LEVEL=verbose")
+
+	// only the end of the output is kept
+	output, err := ioutil.ReadFile(filepath.Join(dir, termtest.ArtifactOutput))
+	suite.Require().NoError(err)
+	suite.Len(output, 64)
+	suite.Contains(string(output), "stuttered 20 times")
+	suite.NotContains(string(output), "stuttered 1 times")
+}
+
+func (suite *TermTestTestSuite) TestNewTestArtifactsDir() {
+	if dir, ok := os.LookupEnv(termtest.ArtifactsDirEnv); ok {
+		os.Unsetenv(termtest.ArtifactsDirEnv)
+		defer os.Setenv(termtest.ArtifactsDirEnv, dir)
+	}
+	tb := &cleanupTB{TB: suite.T()}
+	cp, err := termtest.NewTest(tb, termtest.Options{
+		CmdName:  suite.sessionTester,
+		CastFile: filepath.Join(suite.tmpDir, "artifacts-dir.cast"),
+	})
+	suite.Require().NoError(err)
+
+	_, err = cp.ExpectExitCode(0, 10*time.Second)
+	suite.Require().NoError(err)
+	tb.Errorf("the test fails")
+	tb.runCleanups()
+
+	// the artifacts are written to the temporary directory of the test
+	var dir string
+	for _, l := range tb.logs {
+		if strings.HasPrefix(l, "Test artifacts written to ") {
+			dir = strings.TrimPrefix(l, "Test artifacts written to ")
+		}
+	}
+	suite.Require().NotEmpty(dir, "logs: %v", tb.logs)
+	suite.Equal(filepath.Dir(suite.T().TempDir()), filepath.Dir(dir))
+	suite.FileExists(filepath.Join(dir, termtest.ArtifactScreen))
+}
@@ -0,0 +1,351 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	expect "github.com/ActiveState/termtest/expect"
+)
+
+// ErrShellIntegration is returned by the shell integration functions if Options.ShellIntegration is not set
+var ErrShellIntegration = errors.New("shell integration is not enabled")
+
+// The shells print OSC 133 sequences (https://gitlab.freedesktop.org/Per_Bothner/specifications/blob/master/proposals/semantic-prompts.md)
+// around the prompt, before the output of a command (C) and after the command has finished with its
+// exit code (D).  Every shell shows the prompt "$ ", and does not record a history.
+const (
+	bashRC = `unset HISTFILE
+__termtest_prompt() {
+	printf '\033]133;D;%s\007' "$?"
+}
+PROMPT_COMMAND=__termtest_prompt
+PS0='\e]133;C\a'
+PS1='\[\e]133;A\a\]$ \[\e]133;B\a\]'
+`
+	zshRC = `unset HISTFILE
+precmd() {
+	print -n "\e]133;D;$?\a"
+}
+preexec() {
+	print -n "\e]133;C\a"
+}
+PS1=$'%{\e]133;A\a%}$ %{\e]133;B\a%}'
+`
+	fishRC = `set -g fish_history ''
+function __termtest_preexec --on-event fish_preexec
+	printf '\e]133;C\a'
+end
+function __termtest_postexec --on-event fish_postexec
+	printf '\e]133;D;%s\a' $status
+end
+function fish_prompt
+	printf '\e]133;A\a$ \e]133;B\a'
+end
+function fish_greeting
+end
+`
+	// sh has no hooks before a command is executed, the output starts after the command line
+	shRC = `unset HISTFILE
+PS1="$(printf '\033]133;D;')\$?$(printf '\007\033]133;A\007')\$ $(printf '\033]133;B\007')"
+`
+)
+
+// setupShellIntegration writes the configuration of the shell opts.CmdName to a temporary directory
+// that is removed by opts.CleanUp, and adds the arguments and environment variables that make the
+// shell load it
+func setupShellIntegration(opts *Options) error {
+	shell := strings.TrimSuffix(filepath.Base(opts.CmdName), ".exe")
+	env := opts.Environment
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append([]string(nil), env...)
+
+	var name, content string
+	switch shell {
+	case "bash":
+		name, content = "bashrc", bashRC
+	case "zsh":
+		// zsh reads .zshrc from $ZDOTDIR
+		name, content = ".zshrc", zshRC
+	case "fish":
+		name, content = "config.fish", fishRC
+	case "sh", "dash", "ash":
+		name, content = "shrc", shRC
+	default:
+		return fmt.Errorf("shell integration is not supported for %s", opts.CmdName)
+	}
+	dir, err := ioutil.TempDir("", "termtest-shell-")
+	if err != nil {
+		return fmt.Errorf("failed to create shell configuration directory: %w", err)
+	}
+	opts.shellDir = dir
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write shell configuration: %w", err)
+	}
+
+	switch shell {
+	case "bash":
+		opts.Args = append([]string{"--rcfile", path}, opts.Args...)
+	case "zsh":
+		env = append(env, "ZDOTDIR="+dir)
+	case "fish":
+		opts.Args = append([]string{"--init-command", "source " + path}, opts.Args...)
+	default:
+		env = append(env, "ENV="+path)
+	}
+	opts.Environment = env
+	return nil
+}
+
+// ShellCommand is the result of a command run with RunShellCommand
+type ShellCommand struct {
+	// Output is the output of the command with terminal control sequences removed and lines
+	// separated by "\n"
+	Output string
+	// ExitCode is the exit code of the command, or -1 if the shell did not report it
+	ExitCode int
+}
+
+// shellMarkers tracks the OSC 133 sequences in the terminal output
+type shellMarkers struct {
+	mu sync.Mutex
+	// pending holds an escape sequence that has not been completed yet
+	pending []byte
+	// ready is true if the prompt has been shown, and no command has been entered since
+	ready bool
+	// running is true while the output of a command is captured
+	running  bool
+	output   bytes.Buffer
+	finished []ShellCommand
+}
+
+// Write parses the terminal output p
+func (m *shellMarkers) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data := append(m.pending, p...)
+	m.pending = nil
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\033')
+		if i < 0 {
+			m.text(data)
+			break
+		}
+		m.text(data[:i])
+		data = data[i:]
+		n := sequenceLen(data)
+		if n == 0 {
+			// wait for the rest of the sequence
+			m.pending = append([]byte(nil), data...)
+			break
+		}
+		m.sequence(data[:n])
+		data = data[n:]
+	}
+	return len(p), nil
+}
+
+// text handles output that is not part of an escape sequence
+func (m *shellMarkers) text(b []byte) {
+	if m.running {
+		m.output.Write(b)
+		return
+	}
+	if i := bytes.IndexByte(b, '\n'); m.ready && i >= 0 {
+		// a command line has been entered
+		m.ready = false
+		m.running = true
+		m.output.Reset()
+		m.output.Write(b[i+1:])
+	}
+}
+
+// sequence handles the escape sequence seq
+func (m *shellMarkers) sequence(seq []byte) {
+	const prefix = "\033]133;"
+	if !bytes.HasPrefix(seq, []byte(prefix)) {
+		if m.running {
+			m.output.Write(seq)
+		}
+		return
+	}
+	params := strings.Split(strings.TrimRight(strings.TrimPrefix(string(seq), prefix), "\007\033\\"), ";")
+	switch params[0] {
+	case "A":
+		m.ready = false
+	case "B":
+		m.ready = true
+	case "C":
+		m.ready = false
+		m.running = true
+		m.output.Reset()
+	case "D":
+		if !m.running {
+			return
+		}
+		m.running = false
+		exitCode := -1
+		if len(params) > 1 {
+			if code, err := strconv.Atoi(params[1]); err == nil {
+				exitCode = code
+			}
+		}
+		m.finished = append(m.finished, ShellCommand{Output: stripControlSequences(m.output.String()), ExitCode: exitCode})
+		m.output.Reset()
+	}
+}
+
+// sequenceLen returns the length of the escape sequence at the start of b, or 0 if it is incomplete
+func sequenceLen(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	switch b[1] {
+	case '[':
+		// CSI sequences end with a byte in the range 0x40-0x7e
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return 0
+	case ']':
+		// OSC sequences end with BEL or ST
+		for i := 2; i < len(b); i++ {
+			if b[i] == '\007' {
+				return i + 1
+			}
+			if b[i] == '\033' && i+1 < len(b) && b[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return 0
+	case '(', ')', '*', '+':
+		// character set designations
+		if len(b) < 3 {
+			return 0
+		}
+		return 3
+	default:
+		return 2
+	}
+}
+
+// stripControlSequences removes escape sequences and carriage returns from the terminal output s
+func stripControlSequences(s string) string {
+	var res strings.Builder
+	b := []byte(s)
+	for len(b) > 0 {
+		if b[0] == '\033' {
+			n := sequenceLen(b)
+			if n == 0 {
+				break
+			}
+			b = b[n:]
+			continue
+		}
+		if b[0] != '\r' {
+			res.WriteByte(b[0])
+		}
+		b = b[1:]
+	}
+	return res.String()
+}
+
+// state returns whether the prompt is ready and the number of finished commands
+func (m *shellMarkers) state() (bool, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready, len(m.finished)
+}
+
+// command returns the n-th finished command
+func (m *shellMarkers) command(n int) ShellCommand {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.finished[n]
+}
+
+// shellMatcher fulfills the expect.Matcher interface to match a state of the shell
+type shellMatcher struct {
+	criteria string
+	cond     func() bool
+}
+
+func (sm *shellMatcher) Match(_ interface{}) bool {
+	return sm.cond()
+}
+
+func (sm *shellMatcher) Criteria() interface{} {
+	return sm.criteria
+}
+
+// Bulk returns true, as the matcher does not inspect the terminal output
+func (sm *shellMatcher) Bulk() bool {
+	return true
+}
+
+// expectShell waits until cond is met
+func (cp *ConsoleProcess) expectShell(criteria string, cond func() bool, timeout ...time.Duration) (string, error) {
+	if cond() {
+		return cp.rawString(), nil
+	}
+	opts := []expect.ExpectOpt{func(opts *expect.ExpectOpts) error {
+		opts.Matchers = append(opts.Matchers, &shellMatcher{criteria: criteria, cond: cond})
+		return nil
+	}}
+	if len(timeout) > 0 {
+		opts = append(opts, expect.WithTimeout(timeout[0]))
+	}
+
+	return cp.expect(cp.ctx, opts...)
+}
+
+// WaitForPrompt returns once the shell shows its prompt and waits for a command
+// It requires Options.ShellIntegration.
+// Default timeout is 10 seconds
+func (cp *ConsoleProcess) WaitForPrompt(timeout ...time.Duration) (string, error) {
+	if cp.shell == nil {
+		return "", ErrShellIntegration
+	}
+	return cp.expectShell("shell prompt", func() bool {
+		ready, _ := cp.shell.state()
+		return ready
+	}, timeout...)
+}
+
+// RunShellCommand waits for the prompt of the shell, enters the command line and returns the output
+// and the exit code of the command once it has finished
+// It requires Options.ShellIntegration.
+// Default timeout is 10 seconds for the prompt and for the command each
+func (cp *ConsoleProcess) RunShellCommand(cmd string, timeout ...time.Duration) (*ShellCommand, error) {
+	if _, err := cp.WaitForPrompt(timeout...); err != nil {
+		return nil, err
+	}
+	_, n := cp.shell.state()
+	cp.SendLine(cmd)
+	_, err := cp.expectShell(fmt.Sprintf("shell command finished: %s", cmd), func() bool {
+		_, finished := cp.shell.state()
+		return finished > n
+	}, timeout...)
+	if err != nil {
+		return nil, err
+	}
+	res := cp.shell.command(n)
+	return &res, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ActiveState/termtest"
+)
+
+func (suite *TermTestTestSuite) TestRunShellCommand() {
+	if runtime.GOOS == "windows" {
+		suite.T().Skip("the shells are not available on Windows")
+	}
+	for _, shell := range []string{"bash", "zsh", "fish", "sh"} {
+		suite.Run(shell, func() {
+			path, err := exec.LookPath(shell)
+			if err != nil {
+				suite.T().Skipf("%s is not installed", shell)
+			}
+			cp, err := termtest.New(termtest.Options{
+				CmdName:          path,
+				ShellIntegration: true,
+				ObserveExpect:    termtest.TestExpectObserveFn(suite.T()),
+			})
+			suite.Require().NoError(err)
+			defer cp.Close()
+
+			_, err = cp.WaitForInput(10 * time.Second)
+			suite.Require().NoError(err)
+
+			files, err := ioutil.ReadDir(cp.WorkDirectory())
+			suite.Require().NoError(err)
+			suite.Empty(files, "the configuration is not written to the work directory")
+
+			res, err := cp.RunShellCommand("echo hello; echo world", 10*time.Second)
+			suite.Require().NoError(err)
+			suite.Equal("hello\nworld\n", res.Output)
+			suite.Equal(0, res.ExitCode)
+
+			res, err = cp.RunShellCommand("printf 'no newline'; false", 10*time.Second)
+			suite.Require().NoError(err)
+			suite.Equal("no newline", res.Output)
+			suite.Equal(1, res.ExitCode)
+
+			res, err = cp.RunShellCommand("(exit 42)", 10*time.Second)
+			suite.Require().NoError(err)
+			suite.Equal("", res.Output)
+			suite.Equal(42, res.ExitCode)
+
+			cp.SendLine("exit 0")
+			_, _ = cp.ExpectExitCode(0, 10*time.Second)
+		})
+	}
+}
+
+func (suite *TermTestTestSuite) TestShellIntegrationNotEnabled() {
+	cp := suite.spawn(false)
+	defer cp.Close()
+
+	_, err := cp.RunShellCommand("echo hello")
+	suite.True(errors.Is(err, termtest.ErrShellIntegration), "expected shell integration error, got %v", err)
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+}
+
+func (suite *TermTestTestSuite) TestShellIntegrationStartFailure() {
+	tmpDir, err := ioutil.TempDir("", "")
+	suite.Require().NoError(err)
+	defer os.RemoveAll(tmpDir)
+
+	// the work directory and the shell configuration are created in the temporary directory
+	for _, env := range []string{"TMPDIR", "TMP", "TEMP"} {
+		old, ok := os.LookupEnv(env)
+		suite.Require().NoError(os.Setenv(env, tmpDir))
+		if ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+
+	_, err = termtest.New(termtest.Options{
+		CmdName:          filepath.Join(tmpDir, "missing", "sh"),
+		ShellIntegration: true,
+		LogWriter:        ioutil.Discard,
+	})
+	suite.Require().Error(err)
+
+	files, err := ioutil.ReadDir(tmpDir)
+	suite.Require().NoError(err)
+	suite.Empty(files, "the work directory and the shell configuration are removed")
+}
@@ -0,0 +1,257 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ActiveState/termtest/expect"
+)
+
+// UpdateSnapshotsEnv is the environment variable that, when set to a non-empty value, makes
+// ExpectSnapshot write the current terminal output to the golden files instead of comparing it
+const UpdateSnapshotsEnv = "TERMTEST_UPDATE_SNAPSHOTS"
+
+var updateSnapshots int32
+
+// SetUpdateSnapshots makes ExpectSnapshot write the golden files as if UpdateSnapshotsEnv was set.
+// A test package can call it from TestMain, e.g., to update the snapshots with a flag of its own.
+func SetUpdateSnapshots(update bool) {
+	var v int32
+	if update {
+		v = 1
+	}
+	atomic.StoreInt32(&updateSnapshots, v)
+}
+
+// SnapshotOpt configures how a terminal snapshot is compared with its golden file
+type SnapshotOpt func(*snapshotOpts)
+
+type snapshotOpts struct {
+	scrollback  bool
+	normalizers []normalizer
+}
+
+type normalizer struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// WithScrollback includes the scroll-back buffer in the snapshot, not only the visible screen.  The
+// lines are taken from History, such that lines that the terminal has wrapped are joined.
+func WithScrollback() SnapshotOpt {
+	return func(o *snapshotOpts) {
+		o.scrollback = true
+	}
+}
+
+// WithNormalizer replaces all matches of re with repl before the snapshot is compared or stored.
+// This can be used to hide output that changes between test runs.  repl can refer to capture
+// groups like regexp.ReplaceAllString does.
+func WithNormalizer(re *regexp.Regexp, repl string) SnapshotOpt {
+	return func(o *snapshotOpts) {
+		o.normalizers = append(o.normalizers, normalizer{re, repl})
+	}
+}
+
+// NormalizeTimestamps replaces dates and times like 2020-12-01T15:04:05Z or 15:04:05 with <TIMESTAMP>
+var NormalizeTimestamps = WithNormalizer(
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?)?|\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`),
+	"<TIMESTAMP>",
+)
+
+// NormalizeVersions replaces semantic version numbers like 1.2.3 or v1.2.3-rc1 with <VERSION>
+var NormalizeVersions = WithNormalizer(
+	regexp.MustCompile(`\bv?\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?\b`),
+	"<VERSION>",
+)
+
+// SnapshotMismatchError is returned by ExpectSnapshot if the terminal output differs from the golden file
+type SnapshotMismatchError struct {
+	// GoldenFile is the path of the golden file
+	GoldenFile string
+	// Diff is a line-by-line diff between the golden file and the actual output
+	Diff string
+}
+
+func (e *SnapshotMismatchError) Error() string {
+	return fmt.Sprintf("terminal snapshot does not match golden file %s (set %s=1 to update it):\n%s", e.GoldenFile, UpdateSnapshotsEnv, e.Diff)
+}
+
+type snapshotMatcher struct {
+	goldenFile string
+}
+
+func (sm *snapshotMatcher) Match(_ interface{}) bool {
+	return true
+}
+
+func (sm *snapshotMatcher) Criteria() interface{} {
+	return fmt.Sprintf("snapshot matches %s", sm.goldenFile)
+}
+
+// GoldenFile returns the path of the golden file for the snapshot called name in the test t.
+// Golden files are stored in testdata/snapshots/<test name>/<name>.golden
+func GoldenFile(t testing.TB, name string) string {
+	return filepath.Join("testdata", "snapshots", sanitizeFileName(t.Name()), sanitizeFileName(name)+".golden")
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\w\-./#]`)
+
+func sanitizeFileName(name string) string {
+	return unsafeFileChars.ReplaceAllString(name, "_")
+}
+
+// ExpectSnapshot compares the terminal output as a user would see it with the content of the golden file
+// If the environment variable TERMTEST_UPDATE_SNAPSHOTS is set, or SetUpdateSnapshots has been called
+// with true, the golden file is written instead.
+// Trailing spaces and empty lines are ignored, and the work directory is replaced with <WORKDIR>.
+func (cp *ConsoleProcess) ExpectSnapshot(goldenFile string, opts ...SnapshotOpt) error {
+	var o snapshotOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	actual := cp.normalizedSnapshot(o)
+	matchers := []expect.Matcher{&snapshotMatcher{goldenFile}}
+
+	if atomic.LoadInt32(&updateSnapshots) != 0 || os.Getenv(UpdateSnapshotsEnv) != "" {
+		err := os.MkdirAll(filepath.Dir(goldenFile), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(goldenFile, []byte(actual), 0644)
+		}
+		if err != nil {
+			e := fmt.Errorf("failed to update golden file: %w", err)
+			cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+			return e
+		}
+		return nil
+	}
+
+	golden, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		e := fmt.Errorf("failed to read golden file (set %s=1 to create it): %w", UpdateSnapshotsEnv, err)
+		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+		return e
+	}
+
+	expected := strings.ReplaceAll(string(golden), "\r\n", "\n")
+	if expected != actual {
+		e := &SnapshotMismatchError{GoldenFile: goldenFile, Diff: lineDiff(expected, actual)}
+		cp.opts.ObserveExpect(matchers, cp.MatchState(), e)
+		return e
+	}
+	return nil
+}
+
+func (cp *ConsoleProcess) normalizedSnapshot(o snapshotOpts) string {
+	var lines []string
+	if o.scrollback {
+		lines = cp.History()
+	} else {
+		lines = strings.Split(cp.Snapshot(), "\n")
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \r")
+	}
+	content := strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+
+	wd := cp.WorkDirectory()
+	if wd != "" {
+		if resolved, err := filepath.EvalSymlinks(wd); err == nil && resolved != wd {
+			content = strings.ReplaceAll(content, resolved, "<WORKDIR>")
+		}
+		content = strings.ReplaceAll(content, wd, "<WORKDIR>")
+	}
+	for _, n := range o.normalizers {
+		content = n.re.ReplaceAllString(content, n.repl)
+	}
+	return content
+}
+
+// lineDiff returns a line-by-line diff of the strings expected and actual.  Removed lines are
+// prefixed with "-", added lines with "+"
+func lineDiff(expected, actual string) string {
+	a := strings.Split(strings.TrimSuffix(expected, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(actual, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type diffLine struct {
+		prefix string
+		text   string
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{" ", a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{"-", a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{"+", b[j]})
+			j++
+		}
+	}
+
+	// only print unchanged lines that are close to a change
+	const context = 3
+	show := make([]bool, len(lines))
+	for k, l := range lines {
+		if l.prefix == " " {
+			continue
+		}
+		for c := k - context; c <= k+context; c++ {
+			if c >= 0 && c < len(lines) {
+				show[c] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- golden\n+++ actual\n")
+	skipped := false
+	for k, l := range lines {
+		if !show[k] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			sb.WriteString("...\n")
+			skipped = false
+		}
+		fmt.Fprintf(&sb, "%s %s\n", l.prefix, l.text)
+	}
+	if skipped {
+		sb.WriteString("...\n")
+	}
+	return sb.String()
+}
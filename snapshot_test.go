@@ -0,0 +1,105 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package termtest_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ActiveState/termtest"
+	expect "github.com/ActiveState/termtest/expect"
+)
+
+func (suite *TermTestTestSuite) TestSnapshot() {
+	cp := suite.spawn(false)
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	err := cp.ExpectSnapshot(
+		termtest.GoldenFile(suite.T(), "expected"),
+		termtest.WithNormalizer(regexp.MustCompile("expected"), "<X>"),
+	)
+	suite.NoError(err)
+}
+
+func (suite *TermTestTestSuite) TestSnapshotMismatch() {
+	golden := filepath.Join(suite.tmpDir, "mismatch.golden")
+	err := ioutil.WriteFile(golden, []byte("an unexpected string\n"), 0644)
+	suite.Require().NoError(err)
+
+	var observed error
+	cp := suite.spawnCustom(false, func(matchers []expect.Matcher, ms *expect.MatchState, err error) {
+		observed = err
+	})
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	err = cp.ExpectSnapshot(golden)
+	suite.Require().Error(err)
+	suite.Equal(err, observed)
+
+	var mismatch *termtest.SnapshotMismatchError
+	suite.Require().True(errors.As(err, &mismatch))
+	suite.Equal(golden, mismatch.GoldenFile)
+	suite.Equal("--- golden\n+++ actual\n- an unexpected string\n+ an expected string\n", mismatch.Diff)
+}
+
+func (suite *TermTestTestSuite) TestSnapshotUpdate() {
+	golden := filepath.Join(suite.tmpDir, "update", "snapshot.golden")
+	os.Setenv(termtest.UpdateSnapshotsEnv, "1")
+	defer os.Unsetenv(termtest.UpdateSnapshotsEnv)
+
+	cp := suite.spawn(false)
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	suite.NoError(cp.ExpectSnapshot(golden, termtest.WithScrollback()))
+
+	content, err := ioutil.ReadFile(golden)
+	suite.Require().NoError(err)
+	suite.Equal("an expected string\n", string(content))
+}
+
+func (suite *TermTestTestSuite) TestSetUpdateSnapshots() {
+	golden := filepath.Join(suite.tmpDir, "setter", "snapshot.golden")
+	termtest.SetUpdateSnapshots(true)
+	defer termtest.SetUpdateSnapshots(false)
+
+	cp := suite.spawn(false)
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	suite.NoError(cp.ExpectSnapshot(golden))
+
+	content, err := ioutil.ReadFile(golden)
+	suite.Require().NoError(err)
+	suite.Equal("an expected string\n", string(content))
+}
+
+func (suite *TermTestTestSuite) TestSnapshotScrollbackHistory() {
+	golden := filepath.Join(suite.tmpDir, "history", "snapshot.golden")
+	termtest.SetUpdateSnapshots(true)
+	defer termtest.SetUpdateSnapshots(false)
+
+	cp := suite.spawn(false, "-fill-buffer")
+	defer cp.Close()
+
+	_, _ = cp.ExpectExitCode(0, 10*time.Second)
+	suite.NoError(cp.ExpectSnapshot(golden, termtest.WithScrollback()))
+
+	content, err := ioutil.ReadFile(golden)
+	suite.Require().NoError(err)
+	lines := strings.Split(string(content), "\n")
+	suite.Require().Len(lines, 3)
+	suite.Equal("an expected string", lines[0])
+	// the rows that the terminal has wrapped are joined
+	suite.True(strings.HasPrefix(lines[1], ":000:5678"), "the oldest output is in the snapshot")
+	suite.True(strings.HasSuffix(lines[1], ":299:"+strings.Repeat("5678901234", 7)+"56789"), "the newest output is in the snapshot")
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // TestSendObserveFn is an example for a SendObserver function, it reports any error during Send calls to the supplied testing instance
-func TestSendObserveFn(t *testing.T) func(string, int, error) {
+func TestSendObserveFn(t testing.TB) func(string, int, error) {
 	return func(msg string, num int, err error) {
 		if err == nil {
 			return
@@ -24,7 +24,7 @@ func TestSendObserveFn(t *testing.T) func(string, int, error) {
 }
 
 // TestExpectObserveFn an example for a ExpectObserver function, it reports any error occurring durint expect calls to the supplied testing instance
-func TestExpectObserveFn(t *testing.T) expect.ExpectObserver {
+func TestExpectObserveFn(t testing.TB) expect.ExpectObserver {
 	return func(matchers []expect.Matcher, ms *expect.MatchState, err error) {
 		if err == nil {
 			return
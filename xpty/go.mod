@@ -10,7 +10,7 @@ require (
 	github.com/kr/pty v1.1.8 // indirect
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.0.0-20200427165652-729f1e841bcc
-	golang.org/x/sys v0.0.0-20200821140526-fda516888d29 // indirect
+	golang.org/x/sys v0.0.0-20200821140526-fda516888d29
 )
 
 replace github.com/ActiveState/termtest/conpty => ../conpty
@@ -8,11 +8,11 @@ import (
 	"bufio"
 	"context"
 	"errors"
-	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
-	"unicode"
+	"unicode/utf8"
 )
 
 type errPassthroughTimeout struct {
@@ -21,15 +21,46 @@ type errPassthroughTimeout struct {
 
 func (errPassthroughTimeout) Timeout() bool { return true }
 
+// chunkSize is the maximum number of bytes the reader goroutine reads at once
+const chunkSize = 4096
+
+// chunk is a piece of data read from the underlying reader, or the error that
+// ended reading from it
+type chunk struct {
+	data []byte
+	err  error
+}
+
 // PassthroughPipe pipes data from a io.Reader and allows setting a read
 // deadline. If a timeout is reached the error is returned, otherwise the error
 // from the provided io.Reader returned is passed through instead.
+//
+// A single goroutine reads from the io.Reader and queues the data for the
+// readers of the PassthroughPipe.  The PassthroughPipe must not be read from
+// concurrently.
 type PassthroughPipe struct {
-	rdr      *bufio.Reader
-	deadline time.Time
-	ctx      context.Context
-	cancel   context.CancelFunc
-	lastRead int64
+	rdr    *bufio.Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+	chunks chan chunk
+
+	// consumer state, only accessed by the reading goroutine
+	cur     []byte // unread part of the current chunk
+	readErr error  // error that ended the input, returned once cur has been read
+
+	pending int64 // number of bytes read from rdr, but not from the pipe
+	expired int32 // set to 1 once the deadline has expired
+
+	mu              sync.Mutex
+	deadline        time.Time
+	deadlineTimer   *time.Timer
+	deadlineGen     int
+	readerWaiting   bool          // true while the reader goroutine waits for new data from rdr
+	readerDone      bool          // true once rdr has returned an error
+	consumerWaiting bool          // true while a read on the pipe waits for new data
+	isBlocked       bool          // the blocked state as of the last update
+	blocked         chan struct{} // closed while the pipe is blocked
+	changed         chan struct{} // closed when the pipe becomes blocked or unblocked
 }
 
 var maxTime = time.Unix(1<<60-1, 999999999)
@@ -44,83 +75,249 @@ func NewPassthroughPipe(r *bufio.Reader) *PassthroughPipe {
 		deadline: maxTime,
 		ctx:      ctx,
 		cancel:   cancel,
+		chunks:   make(chan chunk, 64),
+		blocked:  make(chan struct{}),
+		changed:  make(chan struct{}),
 	}
 
+	go p.readLoop()
+
 	return &p
 }
 
-// IsBlocked returns true when the PassthroughPipe is (most likely) blocked reading ie., waiting for input
+// readLoop continuously reads from the underlying reader and queues the data until the reader returns
+// an error or the pipe is closed
+func (p *PassthroughPipe) readLoop() {
+	for {
+		buf := make([]byte, chunkSize)
+
+		// The pipe may be blocked while we wait for the underlying reader to produce new data
+		waiting := p.rdr.Buffered() == 0
+		if waiting {
+			p.update(func() { p.readerWaiting = true })
+		}
+		n, err := p.rdr.Read(buf)
+		p.update(func() {
+			p.readerWaiting = false
+			atomic.AddInt64(&p.pending, int64(n))
+			p.readerDone = err != nil
+		})
+
+		if n > 0 {
+			select {
+			case p.chunks <- chunk{data: buf[:n]}:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			select {
+			case p.chunks <- chunk{err: err}:
+			case <-p.ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// IsBlocked returns true when the PassthroughPipe is blocked reading ie., all data written to the
+// underlying reader has been consumed and a read is waiting for new input, or the underlying reader
+// has returned an error and no more data can arrive.
 func (p *PassthroughPipe) IsBlocked() bool {
-	lr := atomic.LoadInt64(&p.lastRead)
-	return time.Duration(time.Now().UTC().UnixNano()-lr) > 100*time.Millisecond
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isBlocked
+}
+
+// Blocked returns a channel that is closed as soon as the PassthroughPipe is blocked
+// (see IsBlocked).
+func (p *PassthroughPipe) Blocked() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.blocked
+}
+
+// blockedState returns whether the pipe is blocked, and a channel that is closed once that changes
+func (p *PassthroughPipe) blockedState() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isBlocked, p.changed
+}
+
+// update modifies the state of the pipe with f, and opens and closes the blocked channel accordingly
+func (p *PassthroughPipe) update(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f()
+	isBlocked := atomic.LoadInt64(&p.pending) == 0 && (p.readerDone || (p.readerWaiting && p.consumerWaiting))
+	if isBlocked == p.isBlocked {
+		return
+	}
+	p.isBlocked = isBlocked
+	if isBlocked {
+		close(p.blocked)
+	} else {
+		p.blocked = make(chan struct{})
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
 }
 
 // SetReadDeadline sets a deadline for a successful read
 func (p *PassthroughPipe) SetReadDeadline(d time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	p.deadline = d
+	p.deadlineGen++
+	if p.deadlineTimer != nil {
+		p.deadlineTimer.Stop()
+	}
+
+	// mark the deadline as expired with a timer, such that reads do not need to check the time
+	dur := time.Until(d)
+	if dur <= 0 {
+		atomic.StoreInt32(&p.expired, 1)
+		return
+	}
+	atomic.StoreInt32(&p.expired, 0)
+	gen := p.deadlineGen
+	p.deadlineTimer = time.AfterFunc(dur, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if gen == p.deadlineGen {
+			atomic.StoreInt32(&p.expired, 1)
+		}
+	})
 }
 
 // Close releases all resources allocated by the pipe
 func (p *PassthroughPipe) Close() error {
 	p.cancel()
-	return nil
-}
 
-type runeResponse struct {
-	rune rune
-	size int
-	err  error
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.deadlineTimer != nil {
+		p.deadlineTimer.Stop()
+	}
+	return nil
 }
 
 // ReadRune reads from the PassthroughPipe and errors out if no data has been written to the pipe before the read deadline expired
 // If read is called after the PassthroughPipe has been closed `0, io.EOF` is returned
 func (p *PassthroughPipe) ReadRune() (rune, int, error) {
-	cs := make(chan runeResponse)
-	done := make(chan struct{})
-	defer close(done)
-	atomic.StoreInt64(&p.lastRead, time.Now().UTC().UnixNano())
+	return p.ReadRuneContext(context.Background())
+}
 
-	go func() {
-		defer close(cs)
+// ReadRuneContext is like ReadRune, but it also returns the context's error if ctx is done before a rune could be read
+func (p *PassthroughPipe) ReadRuneContext(ctx context.Context) (rune, int, error) {
+	if err := p.fill(ctx, utf8.FullRune); err != nil {
+		return rune(0), 0, err
+	}
+	if len(p.cur) == 0 {
+		return rune(0), 0, p.readErr
+	}
 
-		if p.ctx.Err() != nil || p.deadline.Before(time.Now()) {
-			return
+	r, sz := utf8.DecodeRune(p.cur)
+	p.consume(sz)
+	return r, sz, nil
+}
+
+// Read reads up to len(b) bytes from the PassthroughPipe.  It blocks until at least one byte is
+// available, and errors out if no data has been written to the pipe before the read deadline expired.
+func (p *PassthroughPipe) Read(b []byte) (int, error) {
+	return p.ReadContext(context.Background(), b)
+}
+
+// ReadContext is like Read, but it also returns the context's error if ctx is done before data could be read
+func (p *PassthroughPipe) ReadContext(ctx context.Context, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	hasData := func(buf []byte) bool { return len(buf) > 0 }
+	if err := p.fill(ctx, hasData); err != nil {
+		return 0, err
+	}
+	if len(p.cur) == 0 {
+		return 0, p.readErr
+	}
+
+	n := copy(b, p.cur)
+	p.consume(n)
+	return n, nil
+}
+
+// consume removes n bytes from the current chunk
+func (p *PassthroughPipe) consume(n int) {
+	p.cur = p.cur[n:]
+	if len(p.cur) == 0 {
+		p.cur = nil
+	}
+	if atomic.AddInt64(&p.pending, -int64(n)) == 0 {
+		p.update(func() {})
+	}
+}
+
+// fill waits for data until complete(p.cur) returns true or the input has ended.  It returns an
+// error if the deadline expires, the pipe is closed or ctx is done before.
+func (p *PassthroughPipe) fill(ctx context.Context, complete func([]byte) bool) error {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
 		}
+	}()
 
-		var (
-			r   rune
-			sz  int
-			err error
-		)
-		for {
-			r, sz, err = p.rdr.ReadRune()
-
-			if err != nil && r == unicode.ReplacementChar && sz == 1 {
-				if p.rdr.Buffered() > 0 {
-					err = fmt.Errorf("invalid utf8 sequence")
-					break
-				}
-				continue
-			}
-			break
+	for {
+		if p.ctx.Err() != nil {
+			return io.EOF
+		}
+		if atomic.LoadInt32(&p.expired) == 1 {
+			return &errPassthroughTimeout{errors.New("passthrough i/o timeout")}
+		}
+		if complete(p.cur) || p.readErr != nil {
+			return nil
 		}
 
+		// take queued data without blocking first, such that the pipe is only considered blocked
+		// when it is actually waiting for new input
+		var c chunk
 		select {
-		case <-done:
-			return
+		case c = <-p.chunks:
 		default:
-			cs <- runeResponse{r, sz, err}
-		}
-	}()
-
-	select {
-	case c := <-cs:
-		return c.rune, c.size, c.err
+			if timer == nil {
+				p.mu.Lock()
+				deadline := p.deadline
+				p.mu.Unlock()
+				timer = time.NewTimer(time.Until(deadline))
+			}
+			p.update(func() { p.consumerWaiting = true })
+			select {
+			case c = <-p.chunks:
+			case <-p.ctx.Done():
+			case <-ctx.Done():
+			case <-timer.C:
+			}
+			p.update(func() { p.consumerWaiting = false })
 
-	case <-p.ctx.Done():
-		return rune(0), 0, io.EOF
+			if c.data == nil && c.err == nil {
+				if p.ctx.Err() != nil {
+					return io.EOF
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return &errPassthroughTimeout{errors.New("passthrough i/o timeout")}
+			}
+		}
 
-	case <-time.After(p.deadline.Sub(time.Now())):
-		return rune(0), 0, &errPassthroughTimeout{errors.New("passthrough i/o timeout")}
+		if c.err != nil {
+			p.readErr = c.err
+		} else if len(p.cur) == 0 {
+			p.cur = c.data
+		} else {
+			p.cur = append(p.cur, c.data...)
+		}
 	}
 }
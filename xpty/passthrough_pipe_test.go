@@ -6,6 +6,8 @@ package xpty
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"testing"
@@ -185,3 +187,126 @@ func TestPassthroughPipeTimeout(t *testing.T) {
 	require.Equal(t, 0, n)
 	require.Error(t, err, "i/o deadline exceeded")
 }
+
+func TestPassthroughPipeContext(t *testing.T) {
+	_, _, p, close := prepare()
+	defer close()
+
+	p.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, n, err := p.ReadRuneContext(ctx)
+	require.Equal(t, 0, n)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 5*time.Second, "returned when the context was done")
+}
+
+func TestPassthroughPipeRead(t *testing.T) {
+	_, w, p, close := prepare()
+	defer close()
+
+	p.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	go func() {
+		_, err := w.Write([]byte("hello world"))
+		require.NoError(t, err)
+		err = w.Close()
+		require.NoError(t, err)
+	}()
+
+	var res []byte
+	buf := make([]byte, 4)
+	for {
+		n, err := p.Read(buf)
+		res = append(res, buf[:n]...)
+		if err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+		require.NotZero(t, n, "read returns data")
+	}
+	require.Equal(t, "hello world", string(res))
+}
+
+func TestPassthroughPipeBlocked(t *testing.T) {
+	_, w, p, close := prepare()
+	defer close()
+
+	p.SetReadDeadline(time.Now().Add(2 * time.Second))
+	require.False(t, p.IsBlocked(), "not blocked before a read")
+
+	go func() {
+		_, err := w.Write([]byte("a"))
+		require.NoError(t, err)
+	}()
+	r, _, err := p.ReadRune()
+	require.NoError(t, err)
+	require.Equal(t, 'a', r)
+	require.False(t, p.IsBlocked(), "not blocked after a read")
+
+	res := make(chan rune)
+	go func() {
+		r, _, _ := p.ReadRune()
+		res <- r
+	}()
+
+	select {
+	case <-p.Blocked():
+	case <-time.After(time.Second):
+		t.Fatal("expected pipe to be blocked waiting for input")
+	}
+	require.True(t, p.IsBlocked())
+
+	_, err = w.Write([]byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, 'b', <-res)
+	require.False(t, p.IsBlocked(), "not blocked after new input has been read")
+
+	err = w.Close()
+	require.NoError(t, err)
+	_, _, err = p.ReadRune()
+	require.Equal(t, io.EOF, err)
+	require.True(t, p.IsBlocked(), "blocked after reader is exhausted")
+}
+
+func benchmarkPassthroughPipe(b *testing.B, size int, bulk bool) {
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz\n"), size/37+1)[:size]
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, w, p, close := prepare()
+		p.SetReadDeadline(time.Now().Add(time.Minute))
+		go func() {
+			_, _ = w.Write(data)
+			_ = w.Close()
+		}()
+
+		var n int
+		buf := make([]byte, 4096)
+		for {
+			var sz int
+			var err error
+			if bulk {
+				sz, err = p.Read(buf)
+			} else {
+				_, sz, err = p.ReadRune()
+			}
+			if err != nil {
+				break
+			}
+			n += sz
+		}
+		close()
+		if n != size {
+			b.Fatalf("read %d bytes, expected %d", n, size)
+		}
+	}
+}
+
+func BenchmarkPassthroughPipe64KB(b *testing.B)    { benchmarkPassthroughPipe(b, 64*1024, false) }
+func BenchmarkPassthroughPipe1MB(b *testing.B)     { benchmarkPassthroughPipe(b, 1024*1024, false) }
+func BenchmarkPassthroughPipeRead1MB(b *testing.B) { benchmarkPassthroughPipe(b, 1024*1024, true) }
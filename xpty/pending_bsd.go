@@ -0,0 +1,19 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build darwin dragonfly netbsd openbsd
+
+package xpty
+
+import (
+	"os"
+)
+
+// fionread is the FIONREAD ioctl request, _IOR('f', 127, int)
+const fionread = 0x4004667f
+
+// pendingBytes returns the number of bytes that can be read from f without blocking
+func pendingBytes(f *os.File) (int, error) {
+	return ioctlGetInt(f, fionread)
+}
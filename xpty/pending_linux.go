@@ -0,0 +1,16 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package xpty
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// pendingBytes returns the number of bytes that can be read from f without blocking
+func pendingBytes(f *os.File) (int, error) {
+	return ioctlGetInt(f, unix.TIOCINQ)
+}
@@ -0,0 +1,17 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build solaris
+
+package xpty
+
+import (
+	"errors"
+	"os"
+)
+
+// pendingBytes is not supported on this platform
+func pendingBytes(f *os.File) (int, error) {
+	return 0, errors.New("not supported")
+}
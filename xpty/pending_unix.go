@@ -0,0 +1,32 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build darwin dragonfly linux netbsd openbsd
+
+package xpty
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioctlGetInt performs an ioctl request on f that returns an integer value.
+// Unlike f.Fd(), this does not put f into blocking mode.
+func ioctlGetInt(f *os.File, req uint) (int, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var ioctlErr error
+	err = rc.Control(func(fd uintptr) {
+		n, ioctlErr = unix.IoctlGetInt(int(fd), req)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, ioctlErr
+}
@@ -0,0 +1,22 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package xpty
+
+import "unicode/utf8"
+
+// CompleteRunes returns the length of the longest prefix of data that does not end with an
+// incomplete UTF-8 sequence.  Terminal output can be read in chunks that split a rune, and the
+// rest of the chunk should be kept until the rune is complete.
+func CompleteRunes(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if utf8.FullRune(data[i:]) {
+				return len(data)
+			}
+			return i
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+package xpty
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// ErrNoProcess is returned when a process is started in the terminal of a stream
+var ErrNoProcess = errors.New("cannot start a process in the terminal of a stream")
+
+// stream is a device that reads the terminal output from a reader and writes the input to a writer
+type stream struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (s *stream) terminalOutPipe() io.Reader {
+	return s.r
+}
+
+func (s *stream) terminalInPipe() io.Writer {
+	return s.w
+}
+
+// resize does nothing, only the virtual terminal is resized
+func (s *stream) resize(cols, rows uint16) error {
+	return nil
+}
+
+// close closes the reader and the writer if they implement io.Closer
+func (s *stream) close() error {
+	var err error
+	for _, v := range []interface{}{s.r, s.w} {
+		if c, ok := v.(io.Closer); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// outputPending returns false, as a stream cannot tell whether output is waiting to be read
+func (s *stream) outputPending() bool {
+	return false
+}
+
+func (s *stream) tty() *os.File {
+	return nil
+}
+
+// terminalOutFd returns an invalid file descriptor, as a stream has no file
+func (s *stream) terminalOutFd() uintptr {
+	return ^uintptr(0)
+}
+
+func (s *stream) startProcessInTerminal(cmd *exec.Cmd) error {
+	return ErrNoProcess
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build solaris
+
+package xpty
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// signalForeground is not supported on this platform
+func signalForeground(f *os.File, sig syscall.Signal) error {
+	return errors.New("not supported")
+}
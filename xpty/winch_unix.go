@@ -0,0 +1,27 @@
+// Copyright 2020 ActiveState Software. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file
+
+// +build darwin dragonfly linux netbsd openbsd
+
+package xpty
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// signalForeground sends sig to the foreground process group of the terminal f
+func signalForeground(f *os.File, sig syscall.Signal) error {
+	pgrp, err := ioctlGetInt(f, unix.TIOCGPGRP)
+	if err != nil {
+		return err
+	}
+	if pgrp <= 0 {
+		// no process has been started in the terminal
+		return nil
+	}
+	return syscall.Kill(-pgrp, sig)
+}
@@ -6,8 +6,10 @@ package xpty
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"time"
@@ -17,13 +19,26 @@ import (
 
 // Xpty reprents an abstract peudo-terminal for the Windows or *nix architecture
 type Xpty struct {
-	*impl  // os specific
+	impl   device // os specific, or a stream
 	Term   *vt10x.VT
 	State  *vt10x.State
 	rwPipe *readWritePipe
 	pp     *PassthroughPipe
 }
 
+// device is the terminal device that the output of the application is read from, and that user
+// input is written to
+type device interface {
+	terminalOutPipe() io.Reader
+	terminalInPipe() io.Writer
+	resize(cols, rows uint16) error
+	close() error
+	outputPending() bool
+	tty() *os.File
+	terminalOutFd() uintptr
+	startProcessInTerminal(cmd *exec.Cmd) error
+}
+
 // readWritePipe is a helper that we use to let the application communicate with a virtual terminal.
 type readWritePipe struct {
 	r *io.PipeReader
@@ -117,8 +132,23 @@ func New(cols uint16, rows uint16, recordHistory bool) (*Xpty, error) {
 	if err != nil {
 		return nil, err
 	}
-	xp := &Xpty{impl: xpImpl, Term: nil, State: &vt10x.State{RecordHistory: recordHistory}}
-	err = xp.openVT(cols, rows)
+	return newXpty(xpImpl, cols, rows, recordHistory)
+}
+
+// NewStream creates an Xpty of the given size that reads the terminal output from r and writes
+// the user input to w instead of a pseudo-terminal.  If w is nil, the input is discarded.
+// This can be used to replay recorded terminal output, or to connect to a remote terminal.
+// No process can be started in the terminal of a stream.
+func NewStream(cols uint16, rows uint16, recordHistory bool, r io.Reader, w io.Writer) (*Xpty, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	return newXpty(&stream{r: r, w: w}, cols, rows, recordHistory)
+}
+
+func newXpty(dev device, cols uint16, rows uint16, recordHistory bool) (*Xpty, error) {
+	xp := &Xpty{impl: dev, Term: nil, State: &vt10x.State{RecordHistory: recordHistory}}
+	err := xp.openVT(cols, rows)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +158,12 @@ func New(cols uint16, rows uint16, recordHistory bool) (*Xpty, error) {
 
 // ReadRune reads a single rune from the terminal output pipe, and updates the terminal
 func (p *Xpty) ReadRune() (rune, int, error) {
-	c, sz, err := p.pp.ReadRune()
+	return p.ReadRuneContext(context.Background())
+}
+
+// ReadRuneContext is like ReadRune, but it also returns the context's error if ctx is done before a rune could be read
+func (p *Xpty) ReadRuneContext(ctx context.Context) (rune, int, error) {
+	c, sz, err := p.pp.ReadRuneContext(ctx)
 	if err != nil {
 		return c, 0, err
 	}
@@ -137,11 +172,32 @@ func (p *Xpty) ReadRune() (rune, int, error) {
 	return c, sz, err
 }
 
+// Read reads raw terminal output from the passthrough pipe into b.
+// Unlike ReadRune, Read does not update the terminal; write the data to Term once it is processed.
+func (p *Xpty) Read(b []byte) (int, error) {
+	return p.ReadContext(context.Background(), b)
+}
+
+// ReadContext is like Read, but it also returns the context's error if ctx is done before data could be read
+func (p *Xpty) ReadContext(ctx context.Context, b []byte) (int, error) {
+	return p.pp.ReadContext(ctx, b)
+}
+
 // SetReadDeadline sets a deadline for a successful read the next rune
 func (p *Xpty) SetReadDeadline(d time.Time) {
 	p.pp.SetReadDeadline(d)
 }
 
+// Terminal returns the virtual terminal that processes the terminal output
+func (p *Xpty) Terminal() *vt10x.VT {
+	return p.Term
+}
+
+// TerminalState returns the state of the virtual terminal
+func (p *Xpty) TerminalState() *vt10x.State {
+	return p.State
+}
+
 // TerminalInPipe returns a writer that can be used to write user input to the pseudo terminal.
 // On unix this is the /dev/ptm file
 func (p *Xpty) TerminalInPipe() io.Writer {
@@ -166,14 +222,21 @@ func (p *Xpty) WriteTo(w io.Writer) (int64, error) {
 }
 
 // WaitTillDrained waits until the PassthroughPipe is blocked in the reading state.
-// When this function returns, the PassthroughPipe should be blocked in the
-// reading state waiting for more input.
+// When this function returns, all terminal output has been consumed and the
+// PassthroughPipe is blocked in the reading state waiting for more input, or
+// the PassthroughPipe has been closed.
 func (p *Xpty) WaitTillDrained() {
 	for {
-		if p.pp.IsBlocked() {
+		blocked, changed := p.pp.blockedState()
+		// The read might have been started just before new output arrived
+		if blocked && !p.impl.outputPending() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-p.pp.ctx.Done():
 			return
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 }
 
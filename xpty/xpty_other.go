@@ -41,8 +41,18 @@ func (p *impl) terminalInPipe() io.Writer {
 	return p.ptm
 }
 
+// resize changes the size of the terminal, the foreground process group of the terminal receives a
+// SIGWINCH signal even if the size has not changed
 func (p *impl) resize(cols uint16, rows uint16) error {
-	return pty.Setsize(p.ptm, &pty.Winsize{Cols: cols, Rows: rows})
+	old, err := pty.GetsizeFull(p.ptm)
+	if serr := pty.Setsize(p.ptm, &pty.Winsize{Cols: cols, Rows: rows}); serr != nil {
+		return serr
+	}
+	if err == nil && old.Cols == cols && old.Rows == rows {
+		// the kernel only signals changes of the size
+		return signalForeground(p.ptm, syscall.SIGWINCH)
+	}
+	return nil
 }
 
 func (p *impl) close() error {
@@ -51,6 +61,12 @@ func (p *impl) close() error {
 	return nil
 }
 
+// outputPending returns true if output is waiting to be read from the terminal
+func (p *impl) outputPending() bool {
+	n, err := pendingBytes(p.ptm)
+	return err == nil && n > 0
+}
+
 func (p *impl) tty() *os.File {
 	return p.pts
 }
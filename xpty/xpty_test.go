@@ -79,3 +79,54 @@ func TestXpty(t *testing.T) {
 	fmt.Printf("Formatted terminal output:\n%s\n", xp.State.String())
 	xp.WaitTillDrained()
 }
+
+func TestStream(t *testing.T) {
+	inR, inW := io.Pipe()
+	xp, err := xpty.NewStream(20, 5, false, strings.NewReader("hello\r\nworld\x1b[6n"), inW)
+	require.NoError(t, err)
+	defer xp.Close()
+
+	// the reply to the cursor position request is written to the input stream
+	replied := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 20)
+		n, _ := inR.Read(buf)
+		replied <- string(buf[:n])
+	}()
+
+	var out bytes.Buffer
+	_, err = xp.WriteTo(&out)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "hello\r\nworld\x1b[6n", out.String())
+	lines := strings.Split(xp.State.String(), "\n")
+	require.Equal(t, "hello", strings.TrimSpace(lines[0]))
+	require.Equal(t, "world", strings.TrimSpace(lines[1]))
+
+	select {
+	case reply := <-replied:
+		require.Equal(t, "\x1b[2;6R", reply)
+	case <-time.After(time.Second):
+		t.Fatal("no reply to the cursor position request")
+	}
+
+	require.Equal(t, xpty.ErrNoProcess, xp.StartProcessInTerminal(exec.Command("true")))
+}
+
+func TestCompleteRunes(t *testing.T) {
+	euro := []byte("€")
+	tests := []struct {
+		data     []byte
+		expected int
+	}{
+		{nil, 0},
+		{[]byte("abc"), 3},
+		{append([]byte("a"), euro...), 4},
+		{append([]byte("a"), euro[:2]...), 1},
+		{euro[:1], 0},
+		// invalid bytes are not held back
+		{[]byte{'a', 0x80}, 2},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, xpty.CompleteRunes(tt.data), "data %q", tt.data)
+	}
+}
@@ -40,6 +40,12 @@ func (p *impl) close() error {
 	return p.Close()
 }
 
+// outputPending returns true if output is waiting to be read from the terminal
+// This information is not available on Windows.
+func (p *impl) outputPending() bool {
+	return false
+}
+
 func (p *impl) tty() *os.File {
 	return nil
 }